@@ -2,51 +2,81 @@ package main
 
 import (
 	"fmt"
+	"hot-coffee/internal/alert"
 	"hot-coffee/internal/dal"
 	"hot-coffee/internal/handler"
 	"hot-coffee/internal/service"
 	"hot-coffee/internal/start"
 	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 )
 
 func main() {
-	portFlag, dirFlag := start.AllFlags()
+	cfg := start.AllFlags()
+	portFlag, dirFlag := cfg.Port, cfg.Dir
 	port := strconv.Itoa(portFlag)
-	start.CreateDir(dirFlag)
+	if err := start.PrepareDir(cfg); err != nil {
+		slog.Error("Failed to prepare data directory", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 	dal.Directory = dirFlag
 
-	inventoryRepo := dal.NewInventoryRepository(dirFlag + "/inventory.json")
-	inventoryService := service.NewInventoryService(inventoryRepo)
+	orderIDs, err := dal.NewIDGenerator(cfg.OrderID)
+	if err != nil {
+		slog.Error("Invalid order id strategy", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	alerts := alert.NewNotifier(alert.Config{WebhookURL: cfg.AlertWebhook, File: cfg.AlertFile})
+
+	store, err := dal.Open(dal.Config{Storage: cfg.Storage, Dir: dirFlag, OrderIDs: orderIDs, LowStock: alerts.LowStock})
+	if err != nil {
+		slog.Error("Failed to open storage", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	inventoryService := service.NewInventoryService(store.Inventory, store.Menu)
 	inventoryHandler := handler.NewInventoryHandler(inventoryService)
 
-	menuRepo := dal.NewMenuRepository(dirFlag+"/menu_items.json", inventoryRepo)
-	menuService := service.NewMenuService(menuRepo)
+	menuService := service.NewMenuService(store.Menu, store.Inventory, store.Orders)
 	menuHandler := handler.NewMenuHandler(menuService)
 
-	orderRepo := dal.NewOrderRepository(dirFlag + "/orders.json")
-	orderService := service.NewOrderService(orderRepo, menuRepo, inventoryRepo)
+	orderService := service.NewOrderService(store.Orders, store.Menu, store.Inventory, store.UnitOfWork)
 	orderHandler := handler.NewOrderHandler(orderService)
 
 	http.HandleFunc("POST /menu", menuHandler.CreateNewMenu)
 	http.HandleFunc("GET /menu", menuHandler.GetAllMenu)
+	http.HandleFunc("GET /menu/availability", menuHandler.GetMenuAvailability)
 	http.HandleFunc("GET /menu/{id}", menuHandler.GetItemMenu)
 	http.HandleFunc("PUT /menu/{id}", menuHandler.UpdateMenu)
+	http.HandleFunc("PATCH /menu/{id}", menuHandler.PatchMenu)
 	http.HandleFunc("DELETE /menu/{id}", menuHandler.DeleteItemFromMenu)
+	http.HandleFunc("POST /menu/{id}/restore", menuHandler.RestoreMenu)
 
 	http.HandleFunc("POST /inventory", inventoryHandler.CreateNewInventory)
 	http.HandleFunc("GET /inventory", inventoryHandler.GetAllInventory)
 	http.HandleFunc("GET /inventory/{id}", inventoryHandler.GetItemInventory)
+	http.HandleFunc("GET /inventory/low-stock", inventoryHandler.GetLowStock)
 	http.HandleFunc("PUT /inventory/{id}", inventoryHandler.UpdateInventory)
+	http.HandleFunc("PATCH /inventory/{id}", inventoryHandler.PatchInventory)
 	http.HandleFunc("DELETE /inventory/{id}", inventoryHandler.DeleteInventory)
+	http.HandleFunc("POST /inventory/{id}/restore", inventoryHandler.RestoreInventory)
+	http.HandleFunc("GET /inventory/{id}/movements", inventoryHandler.GetMovements)
+	http.HandleFunc("POST /inventory/{id}/adjust", inventoryHandler.AdjustInventory)
+	http.HandleFunc("POST /inventory/restock", inventoryHandler.RestockInventory)
+	http.HandleFunc("POST /inventory/{id}/produce", inventoryHandler.ProduceInventory)
 
 	http.HandleFunc("POST /orders", orderHandler.CreateOrder)
 	http.HandleFunc("GET /orders", orderHandler.GetAllOrders)
 	http.HandleFunc("GET /orders/{id}", orderHandler.GetOrder)
 	http.HandleFunc("PUT /orders/{id}", orderHandler.UpdateOrder)
+	http.HandleFunc("PATCH /orders/{id}", orderHandler.PatchOrder)
 	http.HandleFunc("DELETE /orders/{id}", orderHandler.DeleteOrder)
 	http.HandleFunc("POST /orders/{id}/close", orderHandler.StatusClose)
+	http.HandleFunc("POST /orders/{id}/transition", orderHandler.TransitionOrder)
 
 	http.HandleFunc("GET /reports/total-sales", orderHandler.TotalSales)
 	http.HandleFunc("GET /reports/popular-items", orderHandler.TheMostPopularItem)
@@ -0,0 +1,115 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Сколько оповещений может ждать отправки; лишние отбрасываются с предупреждением.
+const queueSize = 100
+
+type Config struct {
+	WebhookURL string
+	File       string
+}
+
+type LowStockAlert struct {
+	Type         string  `json:"type"`
+	IngredientID string  `json:"ingredient_id"`
+	Name         string  `json:"name"`
+	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit"`
+	ReorderPoint float64 `json:"reorder_point"`
+	ParLevel     float64 `json:"par_level,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// Notifier рассылает оповещения о низком остатке: всегда в лог, а также
+// на webhook и в файл, если они заданы. Отправка идёт в отдельной горутине,
+// чтобы не задерживать запросы, изменившие склад.
+type Notifier struct {
+	cfg    Config
+	client *http.Client
+	queue  chan LowStockAlert
+}
+
+func NewNotifier(cfg Config) *Notifier {
+	n := &Notifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan LowStockAlert, queueSize),
+	}
+	go n.run()
+	return n
+}
+
+// LowStock ставит оповещение в очередь. Подходит как dal.LowStockHook.
+func (n *Notifier) LowStock(item models.InventoryItem) {
+	alert := LowStockAlert{
+		Type:         "low_stock",
+		IngredientID: item.IngredientID,
+		Name:         item.Name,
+		Quantity:     item.Quantity,
+		Unit:         item.Unit,
+		ReorderPoint: item.ReorderPoint,
+		ParLevel:     item.ParLevel,
+		CreatedAt:    time.Now().Format(time.RFC3339),
+	}
+
+	select {
+	case n.queue <- alert:
+	default:
+		slog.Warn("Low stock alert dropped", slog.String("ingredient_id", item.IngredientID))
+	}
+}
+
+func (n *Notifier) run() {
+	for alert := range n.queue {
+		slog.Warn("Low stock",
+			slog.String("ingredient_id", alert.IngredientID),
+			slog.Float64("quantity", alert.Quantity),
+			slog.Float64("reorder_point", alert.ReorderPoint))
+
+		payload, err := json.Marshal(alert)
+		if err != nil {
+			slog.Error("Failed to encode alert", slog.String("error", err.Error()))
+			continue
+		}
+		if n.cfg.WebhookURL != "" {
+			n.post(payload)
+		}
+		if n.cfg.File != "" {
+			n.appendFile(payload)
+		}
+	}
+}
+
+func (n *Notifier) post(payload []byte) {
+	resp, err := n.client.Post(n.cfg.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("Failed to send alert webhook", slog.String("error", err.Error()))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("Alert webhook rejected", slog.Int("status", resp.StatusCode))
+	}
+}
+
+func (n *Notifier) appendFile(payload []byte) {
+	file, err := os.OpenFile(n.cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		slog.Error("Failed to open alerts file", slog.String("error", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(payload, '\n')); err != nil {
+		slog.Error("Failed to write alert", slog.String("error", err.Error()))
+	}
+}
@@ -1,52 +1,173 @@
 package dal
 
 import (
-	"encoding/json"
+	"errors"
 	"hot-coffee/internal/errorHandle"
 	"hot-coffee/models"
-	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type InventoryRepository interface {
 	Create(item models.InventoryItem) error
 	GetAll() ([]models.InventoryItem, error)
 	GetItem(id string) (models.InventoryItem, error)
-	Update(item models.InventoryItem, id string) error
-	Delete(id string) error
+	Update(item models.InventoryItem, id, ifMatch string) error
+	Archive(id, archivedAt, ifMatch string) error
 	Calculation(id string, quantity float64) bool
-	ConsumptionOfIngredients(id string, quantity float64, plus bool) error
+	ConsumptionOfIngredients(id string, quantity float64, plus bool, reason models.MovementReason, referenceID string) error
+	GetMovements(id string, from, to time.Time) ([]models.StockMovement, error)
+	Adjust(adjustments []models.StockAdjustment) ([]models.InventoryItem, error)
 }
 
 type inventoryRepo struct {
-	path             string
-	inventoryMap     []models.InventoryItem
-	copyInventoryMap []models.InventoryItem
+	mu           sync.RWMutex
+	path         string
+	inventoryMap []models.InventoryItem
+	movements    []models.StockMovement
+	newMovements []models.StockMovement // ещё не записанные в журнал движения
+	journal      *Journal
+	staged       bool     // копия внутри транзакции, на диск пишет UnitOfWork
+	pending      []string // ID, изменённые внутри транзакции
+	onLowStock   LowStockHook
+	lowStock     []models.InventoryItem // опустились до точки заказа, ещё не сохранены
+	restored     bool                   // загружены из .bak, нужно догнать по архиву журнала
 }
 
-func NewInventoryRepository(path string) InventoryRepository {
-	existingData, err := ioutil.ReadFile(path)
+const movementsFile = "stock_movements.json"
+
+func NewInventoryRepository(path string) (InventoryRepository, error) {
+	return newInventoryRepo(path)
+}
+
+func newInventoryRepo(path string) (*inventoryRepo, error) {
+	inventory, restored, err := readJSON[[]models.InventoryItem](path)
 	if err != nil {
+		return nil, err
+	}
+
+	// Файла движений нет в каталогах, созданных до появления журнала склада.
+	movements, movementsRestored, err := readJSON[[]models.StockMovement](movementsPath(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return &inventoryRepo{path: path, inventoryMap: inventory, movements: movements, restored: restored || movementsRestored}, nil
+}
+
+func movementsPath(inventoryPath string) string {
+	return filepath.Join(filepath.Dir(inventoryPath), movementsFile)
+}
+
+func inventoryKey(item models.InventoryItem) string {
+	return item.IngredientID
+}
+
+func movementKey(movement models.StockMovement) string {
+	return strconv.FormatInt(movement.ID, 10)
+}
+
+// inventoryState — состояние склада до изменения, чтобы вернуть его, если
+// изменение не удалось сохранить.
+type inventoryState struct {
+	items     []models.InventoryItem
+	movements int
+}
+
+// state копирует записи: изменения остатков правят их на месте.
+func (i *inventoryRepo) state() inventoryState {
+	return inventoryState{items: append([]models.InventoryItem(nil), i.inventoryMap...), movements: len(i.movements)}
+}
+
+// save сохраняет изменения записей ids: в журнал, а без журнала — весь файл.
+// Если записать не удалось, в памяти восстанавливается состояние old.
+func (i *inventoryRepo) save(old inventoryState, ids ...string) error {
+	if i.staged {
+		i.pending = append(i.pending, ids...)
 		return nil
 	}
 
-	var inventory []models.InventoryItem
-	var copyInventoryMap []models.InventoryItem
+	err := i.persist(ids)
+	if err != nil {
+		i.inventoryMap, i.movements, i.newMovements = old.items, i.movements[:old.movements], nil
+	} else {
+		notifyLowStock(i.onLowStock, i.lowStock)
+	}
+	i.lowStock = nil
+	return err
+}
+
+func (i *inventoryRepo) persist(ids []string) error {
+	if i.journal == nil {
+		return i.snapshot()
+	}
 
-	if len(existingData) > 0 {
-		err = json.Unmarshal(existingData, &inventory)
-		if err != nil {
-			return nil
-		}
-		err = json.Unmarshal(existingData, &copyInventoryMap)
+	changes, err := i.changes(ids)
+	if err != nil {
+		return err
+	}
+	return i.journal.Append(changes)
+}
+
+// changes собирает записи журнала по изменённым ID и новым движениям.
+func (i *inventoryRepo) changes(ids []string) ([]journalChange, error) {
+	changes, err := collectChanges(storeInventory, i.inventoryMap, inventoryKey, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, movement := range i.newMovements {
+		change, err := putChange(storeMovements, movementKey(movement), movement)
 		if err != nil {
-			return nil
+			return nil, err
 		}
+		changes = append(changes, change)
 	}
+	i.newMovements = nil
+	return changes, nil
+}
 
-	return &inventoryRepo{path: path, inventoryMap: inventory, copyInventoryMap: copyInventoryMap}
+func (i *inventoryRepo) snapshot() error {
+	if err := WriteJSON(i.path, i.inventoryMap); err != nil {
+		return err
+	}
+	return WriteJSON(movementsPath(i.path), nonNil(i.movements))
+}
+
+// record добавляет в журнал склада движение, которое привело item к текущему остатку.
+func (i *inventoryRepo) record(item models.InventoryItem, delta float64, reason models.MovementReason, referenceID string) {
+	if delta == 0 {
+		return
+	}
+
+	var id int64 = 1
+	if len(i.movements) > 0 {
+		id = i.movements[len(i.movements)-1].ID + 1
+	}
+	movement := models.StockMovement{
+		ID:           id,
+		IngredientID: item.IngredientID,
+		Reason:       reason,
+		Delta:        delta,
+		Balance:      item.Quantity,
+		ReferenceID:  referenceID,
+		CreatedAt:    time.Now().Format(timeLayout),
+	}
+	i.movements = append(i.movements, movement)
+	i.newMovements = append(i.newMovements, movement)
+
+	if crossedReorderPoint(item, delta) {
+		i.lowStock = append(i.lowStock, item)
+	}
 }
 
 func (i *inventoryRepo) Create(item models.InventoryItem) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	old := i.state()
+
 	for _, itemsInventory := range i.inventoryMap {
 		if item.IngredientID == itemsInventory.IngredientID {
 			return errorHandle.ItemIdExists
@@ -56,29 +177,25 @@ func (i *inventoryRepo) Create(item models.InventoryItem) error {
 		}
 	}
 	i.inventoryMap = append(i.inventoryMap, item)
-	i.copyInventoryMap = append(i.copyInventoryMap, item)
-
-	updatedData, err := json.MarshalIndent(i.inventoryMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
+	i.record(item, item.Quantity, models.ReasonStockCount, "")
 
-	err = ioutil.WriteFile(i.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+	return i.save(old, item.IngredientID)
 }
 
 func (i *inventoryRepo) GetAll() ([]models.InventoryItem, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	if len(i.inventoryMap) == 0 {
-		return nil, errorHandle.EmptyFile
+		return nil, errorHandle.EmptyFileInventory
 	}
-	return i.inventoryMap, nil
+	return append([]models.InventoryItem(nil), i.inventoryMap...), nil
 }
 
 func (i *inventoryRepo) GetItem(id string) (models.InventoryItem, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	var item models.InventoryItem
 	for _, items := range i.inventoryMap {
 		if items.IngredientID == id {
@@ -89,7 +206,14 @@ func (i *inventoryRepo) GetItem(id string) (models.InventoryItem, error) {
 	return item, errorHandle.NotFoundID
 }
 
-func (i *inventoryRepo) Update(item models.InventoryItem, id string) error {
+// Update заменяет ингредиент, если его версия подходит под ifMatch (If-Match):
+// версия сверяется под той же блокировкой, что и запись. Архивную пометку
+// меняет только Archive.
+func (i *inventoryRepo) Update(item models.InventoryItem, id, ifMatch string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	old := i.state()
+
 	for _, items := range i.inventoryMap {
 		if items.Name == item.Name && items.IngredientID != id {
 			return errorHandle.ItemNameExists
@@ -98,115 +222,145 @@ func (i *inventoryRepo) Update(item models.InventoryItem, id string) error {
 
 	for items := range i.inventoryMap {
 		if i.inventoryMap[items].IngredientID == id {
+			if !models.MatchETag(ifMatch, i.inventoryMap[items].ETag()) {
+				return errorHandle.PreconditionFailed
+			}
+			item.ArchivedAt = i.inventoryMap[items].ArchivedAt
+			delta := item.Quantity - i.inventoryMap[items].Quantity
 			i.inventoryMap[items] = item
-			i.copyInventoryMap[items] = item
+			i.record(item, delta, models.ReasonStockCount, "")
+			return i.save(old, id, item.IngredientID)
 		}
 	}
-
-	updatedData, err := json.MarshalIndent(i.inventoryMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-
-	err = ioutil.WriteFile(i.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+	return errorHandle.NotFoundID
 }
 
-func (i *inventoryRepo) Delete(id string) error {
-	FoundID := false
-	for _, items := range i.inventoryMap {
-		if items.IngredientID == id {
-			FoundID = true
+// Archive помечает ингредиент удалённым (archivedAt) или, с пустой строкой,
+// возвращает его; версия сверяется с ifMatch, как в Update.
+func (i *inventoryRepo) Archive(id, archivedAt, ifMatch string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	old := i.state()
+
+	for n := range i.inventoryMap {
+		if i.inventoryMap[n].IngredientID == id {
+			if !models.MatchETag(ifMatch, i.inventoryMap[n].ETag()) {
+				return errorHandle.PreconditionFailed
+			}
+			i.inventoryMap[n].ArchivedAt = archivedAt
+			return i.save(old, id)
 		}
 	}
+	return errorHandle.NotFoundID
+}
 
-	if !FoundID {
-		return errorHandle.NotFoundID
-	}
-
-	var newInventory []models.InventoryItem
+// Calculation сообщает, хватит ли остатка; из архивного ингредиента не готовят.
+func (i *inventoryRepo) Calculation(id string, quantity float64) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 
-	for _, items := range i.inventoryMap {
-		if items.IngredientID != id {
-			newInventory = append(newInventory, items)
+	for _, item := range i.inventoryMap {
+		if item.IngredientID == id {
+			return !item.Archived() && item.Quantity-quantity >= 0
 		}
 	}
-
-	i.inventoryMap = newInventory
-	i.copyInventoryMap = newInventory
-
-	updatedData, err := json.MarshalIndent(i.inventoryMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-
-	err = ioutil.WriteFile(i.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+	return false
 }
 
-func (i *inventoryRepo) Calculation(id string, quantity float64) bool {
-	yes := false
-	for _, item := range i.copyInventoryMap {
+func (i *inventoryRepo) ConsumptionOfIngredients(id string, quantity float64, plus bool, reason models.MovementReason, referenceID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	old := i.state()
+
+	found := false
+	for _, item := range i.inventoryMap {
 		if item.IngredientID == id {
-			yes = true
+			found = true
 		}
 	}
-
-	if yes == false {
-		return false
-	}
-
-	for item := range i.copyInventoryMap {
-		if i.copyInventoryMap[item].IngredientID == id {
-			if i.copyInventoryMap[item].Quantity-quantity < 0 {
-				existingData, err := ioutil.ReadFile(i.path)
-				if err != nil {
-					return false
-				}
-				err = json.Unmarshal(existingData, &i.copyInventoryMap)
-				if err != nil {
-					return false
-				}
-
-				return false
-			}
-			i.copyInventoryMap[item].Quantity -= quantity
+	if !found {
+		// Вернуть на склад удалённый ингредиент некуда, списать — нельзя.
+		if plus {
+			return nil
 		}
+		return errorHandle.Ingred
 	}
-	return true
-}
 
-func (i *inventoryRepo) ConsumptionOfIngredients(id string, quantity float64, plus bool) error {
 	if plus == false {
 		for item := range i.inventoryMap {
 			if i.inventoryMap[item].IngredientID == id {
+				if i.inventoryMap[item].Quantity-quantity < 0 {
+					return errorHandle.Ingred
+				}
 				i.inventoryMap[item].Quantity = i.inventoryMap[item].Quantity - quantity
+				i.record(i.inventoryMap[item], -quantity, reason, referenceID)
 			}
 		}
 	} else {
 		for item := range i.inventoryMap {
 			if i.inventoryMap[item].IngredientID == id {
 				i.inventoryMap[item].Quantity += quantity
+				i.record(i.inventoryMap[item], quantity, reason, referenceID)
 			}
 		}
 	}
 
-	updatedData, err := json.MarshalIndent(i.inventoryMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
+	return i.save(old, id)
+}
+
+func (i *inventoryRepo) GetMovements(id string, from, to time.Time) ([]models.StockMovement, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	result := []models.StockMovement{}
+	for _, movement := range i.movements {
+		if movement.IngredientID == id && inRange(movement.CreatedAt, from, to) {
+			result = append(result, movement)
+		}
 	}
+	return result, nil
+}
 
-	err = ioutil.WriteFile(i.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
+// Adjust применяет все изменения разом: если хоть один остаток уйдёт ниже
+// нуля или ингредиента нет (или он в архиве), не меняется ничего. Возвращает новые остатки.
+func (i *inventoryRepo) Adjust(adjustments []models.StockAdjustment) ([]models.InventoryItem, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	old := i.state()
+
+	index := make(map[string]int, len(i.inventoryMap))
+	for n, item := range i.inventoryMap {
+		index[item.IngredientID] = n
+	}
+
+	balances := make(map[string]float64)
+	var ids []string
+	for _, adjustment := range adjustments {
+		n, ok := index[adjustment.IngredientID]
+		if !ok || i.inventoryMap[n].Archived() {
+			return nil, errorHandle.NotFoundID
+		}
+		balance, seen := balances[adjustment.IngredientID]
+		if !seen {
+			balance = i.inventoryMap[n].Quantity
+			ids = append(ids, adjustment.IngredientID)
+		}
+		balance += adjustment.Delta
+		if balance < 0 {
+			return nil, errorHandle.NegativeStock
+		}
+		balances[adjustment.IngredientID] = balance
+	}
+
+	for _, adjustment := range adjustments {
+		n := index[adjustment.IngredientID]
+		i.inventoryMap[n].Quantity += adjustment.Delta
+		i.record(i.inventoryMap[n], adjustment.Delta, adjustment.Reason, adjustment.ReferenceID)
+	}
+
+	result := make([]models.InventoryItem, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, i.inventoryMap[index[id]])
 	}
-	return nil
+	return result, i.save(old, ids...)
 }
@@ -0,0 +1,382 @@
+package dal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/errorHandle"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	journalFile    = "journal.jsonl"
+	journalArchive = "journal-archive"
+	snapshotFile   = "snapshot.json"
+
+	storeInventory = "inventory"
+	storeMovements = "movements"
+	storeOrders    = "orders"
+
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// Сколько записей журнала накапливается до сжатия в снимки inventory.json и orders.json.
+const compactEvery = 500
+
+// journalEntry — одна строка журнала. Все изменения строки применяются
+// вместе, поэтому транзакция UnitOfWork всегда записывается одной строкой.
+type journalEntry struct {
+	Seq     uint64          `json:"seq"`
+	At      string          `json:"at"`
+	Changes []journalChange `json:"changes"`
+}
+
+type journalChange struct {
+	Store string          `json:"store"`
+	Op    string          `json:"op"`
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Journal — журнал изменений заказов и склада (JSON lines) только на дозапись.
+// При запуске он проигрывается поверх последних снимков, а при сжатии
+// переносится в journal-archive и остаётся как история изменений.
+type Journal struct {
+	mu      sync.Mutex
+	dir     string
+	file    *os.File
+	seq     uint64
+	entries int
+	compact chan struct{}
+}
+
+var archivePattern = regexp.MustCompile(`^journal-(\d+)\.jsonl$`)
+
+func openJournal(dir string) (*Journal, []journalEntry, error) {
+	j := &Journal{dir: dir, compact: make(chan struct{}, 1)}
+	j.seq = lastArchivedSeq(filepath.Join(dir, journalArchive))
+
+	file, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := j.read(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	j.file = file
+	j.entries = len(entries)
+	return j, entries, nil
+}
+
+// read читает все целые записи. Оборванная последняя строка (сбой во время
+// записи) отрезается, чтобы следующие записи не склеились с ней.
+func (j *Journal) read(file *os.File) ([]journalEntry, error) {
+	var entries []journalEntry
+	var good int64
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var entry journalEntry
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				return nil, fmt.Errorf("journal entry at offset %d: %w", good, jsonErr)
+			}
+			entries = append(entries, entry)
+			if entry.Seq > j.seq {
+				j.seq = entry.Seq
+			}
+			good += int64(len(line))
+		} else if len(bytes.TrimSpace(line)) > 0 {
+			slog.Warn("Dropping incomplete journal entry", slog.Int64("offset", good))
+			if err := file.Truncate(good); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+func (j *Journal) Append(changes []journalChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := journalEntry{Seq: j.seq + 1, At: time.Now().Format(time.RFC3339Nano), Changes: changes}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errorHandle.ErrorFormatJson
+	}
+	line = append(line, '\n')
+
+	if _, err := j.file.Write(line); err != nil {
+		slog.Error("Failed to append journal", slog.String("error", err.Error()))
+		return errorHandle.ServerError
+	}
+	if err := j.file.Sync(); err != nil {
+		slog.Error("Failed to sync journal", slog.String("error", err.Error()))
+		return errorHandle.ServerError
+	}
+
+	j.seq = entry.Seq
+	j.entries++
+	if j.entries >= compactEvery {
+		select {
+		case j.compact <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// rotate переносит текущий журнал в архив и начинает новый. Вызывается,
+// когда снимки уже записаны и новых записей в журнал быть не может.
+func (j *Journal) rotate() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.entries == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(j.dir, journalArchive), 0o755); err != nil {
+		return err
+	}
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+
+	current := filepath.Join(j.dir, journalFile)
+	archived := filepath.Join(j.dir, journalArchive, fmt.Sprintf("journal-%012d.jsonl", j.seq))
+	if err := os.Rename(current, archived); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(current, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	j.file = file
+	j.entries = 0
+	return syncDir(j.dir)
+}
+
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// archiveJournal переносит оставшийся журнал в архив без проигрывания,
+// например при повторном заполнении каталога начальными данными.
+func archiveJournal(dir string) error {
+	current := filepath.Join(dir, journalFile)
+	info, err := os.Stat(current)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return os.Remove(current)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, journalArchive), 0o755); err != nil {
+		return err
+	}
+	archived := filepath.Join(dir, journalArchive, fmt.Sprintf("journal-discarded-%s.jsonl", time.Now().Format("20060102T150405")))
+	return os.Rename(current, archived)
+}
+
+// snapshotState — номер последней записи журнала, вошедшей в снимки
+// inventory.json и orders.json.
+type snapshotState struct {
+	Seq uint64 `json:"seq"`
+}
+
+// writeSnapshotSeq пишется после снимков, поэтому его .bak описывает те же
+// прошлые поколения, что и .bak снимков (или ещё более ранние).
+func writeSnapshotSeq(dir string, seq uint64) error {
+	return WriteJSON(filepath.Join(dir, snapshotFile), snapshotState{Seq: seq})
+}
+
+// recoverJournal дополняет записи текущего журнала архивными, которые
+// появились после снимка из .bak: сжатие уже убрало их из journal.jsonl.
+// Если номер прошлого снимка неизвестен или части архива не хватает,
+// состояние не восстановить, и запуск прерывается.
+func recoverJournal(dir string, entries []journalEntry) ([]journalEntry, error) {
+	archiveDir := filepath.Join(dir, journalArchive)
+	state, err := decodeFile[snapshotState](filepath.Join(dir, snapshotFile+backupSuffix))
+	if err != nil && (!os.IsNotExist(err) || lastArchivedSeq(archiveDir) > 0) {
+		return nil, fmt.Errorf("data files are damaged and the backup can't be brought up to date: "+
+			"unknown journal position of the backup (%w); restore the data directory from a copy", err)
+	}
+
+	archived, err := readArchive(archiveDir, state.Seq)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(archived, entries...)
+
+	next := state.Seq + 1
+	for _, entry := range entries {
+		if entry.Seq != next {
+			return nil, fmt.Errorf("data files are damaged and the backup can't be brought up to date: "+
+				"journal entry %d is missing from %s; restore the data directory from a copy", next, archiveDir)
+		}
+		next++
+	}
+	slog.Warn("Replaying archived journal over the backup",
+		slog.Uint64("from_seq", state.Seq+1), slog.Int("entries", len(archived)))
+	return entries, nil
+}
+
+// readArchive читает записи архива с номерами больше after. os.ReadDir
+// сортирует имена, а номер в имени дополнен нулями, поэтому файлы идут по порядку.
+func readArchive(dir string, after uint64) ([]journalEntry, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []journalEntry
+	for _, file := range files {
+		match := archivePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		if seq, err := strconv.ParseUint(match[1], 10, 64); err != nil || seq <= after {
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for n, line := range bytes.Split(bytes.TrimSpace(raw), []byte("\n")) {
+			var entry journalEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", file.Name(), n+1, err)
+			}
+			if entry.Seq > after {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func lastArchivedSeq(dir string) uint64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var last uint64
+	for _, entry := range entries {
+		match := archivePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		if seq, err := strconv.ParseUint(match[1], 10, 64); err == nil && seq > last {
+			last = seq
+		}
+	}
+	return last
+}
+
+func putChange(store, id string, v any) (journalChange, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return journalChange{}, errorHandle.ErrorFormatJson
+	}
+	return journalChange{Store: store, Op: opPut, ID: id, Data: data}, nil
+}
+
+// collectChanges превращает изменённые ID в записи журнала по текущему состоянию:
+// есть запись — put, нет — delete.
+func collectChanges[T any](store string, items []T, key func(T) string, ids []string) ([]journalChange, error) {
+	var changes []journalChange
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		change := journalChange{Store: store, Op: opDelete, ID: id}
+		for _, item := range items {
+			if key(item) == id {
+				var err error
+				change, err = putChange(store, id, item)
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// applyChange проигрывает одно изменение журнала поверх среза записей.
+func applyChange[T any](items []T, key func(T) string, change journalChange) ([]T, error) {
+	index := -1
+	for i, item := range items {
+		if key(item) == change.ID {
+			index = i
+			break
+		}
+	}
+
+	switch change.Op {
+	case opDelete:
+		if index >= 0 {
+			items = append(items[:index:index], items[index+1:]...)
+		}
+	case opPut:
+		var item T
+		if err := json.Unmarshal(change.Data, &item); err != nil {
+			return nil, err
+		}
+		if index >= 0 {
+			items[index] = item
+		} else {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("unknown journal operation %q", change.Op)
+	}
+	return items, nil
+}
@@ -0,0 +1,23 @@
+package dal
+
+import "hot-coffee/models"
+
+// LowStockHook получает ингредиент, остаток которого опустился до точки
+// заказа. Вызывается после сохранения изменения, под блокировкой склада,
+// поэтому не должен блокироваться.
+type LowStockHook func(item models.InventoryItem)
+
+// crossedReorderPoint сообщает, что списание delta опустило item до точки заказа.
+func crossedReorderPoint(item models.InventoryItem, delta float64) bool {
+	return item.ReorderPoint > 0 && delta < 0 &&
+		item.Quantity <= item.ReorderPoint && item.Quantity-delta > item.ReorderPoint
+}
+
+func notifyLowStock(hook LowStockHook, items []models.InventoryItem) {
+	if hook == nil {
+		return
+	}
+	for _, item := range items {
+		hook(item)
+	}
+}
@@ -1,49 +1,54 @@
 package dal
 
 import (
-	"encoding/json"
+	"errors"
 	"hot-coffee/internal/errorHandle"
 	"hot-coffee/models"
-	"io/ioutil"
+	"log/slog"
+	"sync"
 )
 
 type MenuRepository interface {
 	Create(item models.MenuItem) error
 	GetAll() ([]models.MenuItem, error)
 	GetItem(id string) (models.MenuItem, error)
-	Update(item models.MenuItem, id string) error
-	Delete(id string) error
-	ExistsByID(id string) bool
-	MenuCalcuation(id string, quantity float64) error
-	MenuConsumptionOfIngredients(id string, quantity float64, plus bool) error
-	SumOfOrder(id string) (float64, error)
+	Update(item models.MenuItem, id, ifMatch string) error
+	Archive(id, archivedAt, ifMatch string) error
+	MenuConsumptionOfIngredients(inventory InventoryRepository, item models.OrderItem, plus bool, reason models.MovementReason, referenceID string) error
+	SumOfOrder(id string) (models.Money, error)
 }
 
 type MenuRepo struct {
-	path           string
-	menuMap        []models.MenuItem
-	inventoryRepos InventoryRepository
+	mu      sync.RWMutex
+	path    string
+	menuMap []models.MenuItem
 }
 
-func NewMenuRepository(path string, inventoryRepos InventoryRepository) MenuRepository {
-	existingData, err := ioutil.ReadFile(path)
+func NewMenuRepository(path string) (MenuRepository, error) {
+	// Меню пишется целиком при каждом изменении, без журнала: из .bak
+	// теряется только последнее изменение.
+	menu, _, err := readJSON[[]models.MenuItem](path)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	var menu []models.MenuItem
+	return &MenuRepo{path: path, menuMap: menu}, nil
+}
 
-	if len(existingData) > 0 {
-		err = json.Unmarshal(existingData, &menu)
-		if err != nil {
-			return nil
-		}
+// save записывает меню; если не удалось, в памяти восстанавливается меню old.
+func (m *MenuRepo) save(old []models.MenuItem) error {
+	if err := WriteJSON(m.path, m.menuMap); err != nil {
+		m.menuMap = old
+		return err
 	}
-
-	return &MenuRepo{path: path, menuMap: menu, inventoryRepos: inventoryRepos}
+	return nil
 }
 
 func (m *MenuRepo) Create(item models.MenuItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := append([]models.MenuItem(nil), m.menuMap...)
+
 	for _, items := range m.menuMap {
 		if items.ID == item.ID {
 			return errorHandle.ItemIdExists
@@ -55,27 +60,23 @@ func (m *MenuRepo) Create(item models.MenuItem) error {
 
 	m.menuMap = append(m.menuMap, item)
 
-	updatedData, err := json.MarshalIndent(m.menuMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-
-	err = ioutil.WriteFile(m.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+	return m.save(old)
 }
 
 func (m *MenuRepo) GetAll() ([]models.MenuItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if len(m.menuMap) == 0 {
 		return nil, errorHandle.EmptyFile
 	}
-	return m.menuMap, nil
+	return append([]models.MenuItem(nil), m.menuMap...), nil
 }
 
 func (m *MenuRepo) GetItem(id string) (models.MenuItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	var item models.MenuItem
 	for _, items := range m.menuMap {
 		if items.ID == id {
@@ -86,7 +87,14 @@ func (m *MenuRepo) GetItem(id string) (models.MenuItem, error) {
 	return item, errorHandle.NotFoundID
 }
 
-func (m *MenuRepo) Update(item models.MenuItem, id string) error {
+// Update заменяет блюдо, если его версия подходит под ifMatch (If-Match):
+// версия сверяется под той же блокировкой, что и запись. Архивную пометку
+// меняет только Archive.
+func (m *MenuRepo) Update(item models.MenuItem, id, ifMatch string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := append([]models.MenuItem(nil), m.menuMap...)
+
 	for _, items := range m.menuMap {
 		if items.Name == item.Name && items.ID != id {
 			return errorHandle.ItemNameExists
@@ -95,92 +103,140 @@ func (m *MenuRepo) Update(item models.MenuItem, id string) error {
 
 	for i := range m.menuMap {
 		if m.menuMap[i].ID == id {
+			if !models.MatchETag(ifMatch, m.menuMap[i].ETag()) {
+				return errorHandle.PreconditionFailed
+			}
+			item.ArchivedAt = m.menuMap[i].ArchivedAt
 			m.menuMap[i] = item
+			return m.save(old)
 		}
 	}
-	updatedData, err := json.MarshalIndent(m.menuMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-	err = ioutil.WriteFile(m.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-	return nil
+	return errorHandle.NotFoundID
 }
 
-func (m *MenuRepo) Delete(id string) error {
-	FoundID := false
+// Archive помечает блюдо удалённым (archivedAt) или, с пустой строкой,
+// возвращает его; версия сверяется с ifMatch, как в Update.
+func (m *MenuRepo) Archive(id, archivedAt, ifMatch string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := append([]models.MenuItem(nil), m.menuMap...)
 
-	for _, item := range m.menuMap {
-		if item.ID == id {
-			FoundID = true
+	for i := range m.menuMap {
+		if m.menuMap[i].ID == id {
+			if !models.MatchETag(ifMatch, m.menuMap[i].ETag()) {
+				return errorHandle.PreconditionFailed
+			}
+			m.menuMap[i].ArchivedAt = archivedAt
+			return m.save(old)
 		}
 	}
-	if !FoundID {
-		return errorHandle.NotFoundID
+	return errorHandle.NotFoundID
+}
+
+func (m *MenuRepo) MenuConsumptionOfIngredients(inventory InventoryRepository, item models.OrderItem, plus bool, reason models.MovementReason, referenceID string) error {
+	recipe, err := orderRecipe(m, item)
+	if err != nil {
+		return err
 	}
+	return recipeConsumption(inventory, recipe, float64(item.Quantity), plus, reason, referenceID)
+}
 
-	var menu []models.MenuItem
+func (m *MenuRepo) SumOfOrder(id string) (models.Money, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	for _, item := range m.menuMap {
-		if item.ID != id {
-			menu = append(menu, item)
+	for _, itemMenu := range m.menuMap {
+		if id == itemMenu.ID {
+			return itemMenu.Price, nil
 		}
 	}
-	m.menuMap = menu
+	return models.Money{}, errorHandle.ItemIdExists
+}
 
-	updatedData, err := json.MarshalIndent(m.menuMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
+// orderRecipe берёт рецепт, сохранённый в позиции при заказе. Для позиций
+// из заказов, оформленных до этого, рецепт собирается по текущему меню;
+// если блюда уже нет в меню, списывать и возвращать нечего, а если из него
+// убрали выбранный вариант или модификатор — берётся рецепт по умолчанию,
+// чтобы заказ всё равно можно было отменить.
+func orderRecipe(menu MenuRepository, item models.OrderItem) ([]models.MenuItemIngredient, error) {
+	if item.Recipe != nil {
+		return item.Recipe, nil
+	}
+	menuItem, err := menu.GetItem(item.ProductID)
+	if errors.Is(err, errorHandle.NotFoundID) {
+		return nil, nil
 	}
-	err = ioutil.WriteFile(m.path, updatedData, 0o644)
 	if err != nil {
-		return errorHandle.ServerError
+		return nil, err
 	}
-	return nil
+	recipe, _, err := menuItem.Recipe(item.Variants, item.Modifiers)
+	if errors.Is(err, errorHandle.InvalidOption) {
+		slog.Warn("Order item options are no longer on the menu, using the default recipe", slog.String("product_id", item.ProductID))
+		recipe, _, err = menuItem.Recipe(nil, nil)
+	}
+	return recipe, err
 }
 
-func (m *MenuRepo) ExistsByID(id string) bool {
-	for _, item := range m.menuMap {
-		if item.ID == id {
-			return true
+// StockRecipe переводит строки рецепта в единицы склада: так рецепт
+// сохраняется в заказе и не зависит от того, как потом поменяют меню.
+func StockRecipe(inventory InventoryRepository, recipe []models.MenuItemIngredient) ([]models.MenuItemIngredient, error) {
+	result := make([]models.MenuItemIngredient, 0, len(recipe))
+	for _, line := range recipe {
+		item, err := inventory.GetItem(line.IngredientID)
+		if err != nil {
+			return nil, errorHandle.Ingred
 		}
+		quantity := line.Quantity
+		if line.Unit != "" {
+			if quantity, err = models.ConvertQuantity(line.Quantity, line.Unit, item.Unit); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, models.MenuItemIngredient{IngredientID: line.IngredientID, Quantity: quantity, Unit: item.Unit})
 	}
-	return false
+	return result, nil
 }
 
-func (m *MenuRepo) MenuCalcuation(id string, quantity float64) error {
-	for _, itemMenu := range m.menuMap {
-		if itemMenu.ID == id {
-			for _, itemIng := range itemMenu.Ingredients {
-				if yes := m.inventoryRepos.Calculation(itemIng.IngredientID, itemIng.Quantity*quantity); !yes {
-					return errorHandle.Ingred
-				}
-			}
-		}
+// stockQuantity переводит количество ингредиента рецепта в единицы склада.
+func stockQuantity(inventory InventoryRepository, itemIng models.MenuItemIngredient, quantity float64) (float64, error) {
+	if itemIng.Unit == "" {
+		return itemIng.Quantity * quantity, nil
 	}
-	return nil
+	item, err := inventory.GetItem(itemIng.IngredientID)
+	if err != nil {
+		return 0, errorHandle.Ingred
+	}
+	return models.ConvertQuantity(itemIng.Quantity*quantity, itemIng.Unit, item.Unit)
 }
 
-func (m *MenuRepo) MenuConsumptionOfIngredients(id string, quantity float64, plus bool) error {
-	for _, itemMenu := range m.menuMap {
-		if itemMenu.ID == id {
-			for _, itemIng := range itemMenu.Ingredients {
-				if err := m.inventoryRepos.ConsumptionOfIngredients(itemIng.IngredientID, itemIng.Quantity*quantity, plus); err != nil {
-					return errorHandle.ServerError
-				}
-			}
+func recipeCalculation(inventory InventoryRepository, ingredients []models.MenuItemIngredient, quantity float64) error {
+	for _, itemIng := range ingredients {
+		amount, err := stockQuantity(inventory, itemIng, quantity)
+		if err != nil {
+			return err
+		}
+		if yes := inventory.Calculation(itemIng.IngredientID, amount); !yes {
+			return errorHandle.Ingred
 		}
 	}
 	return nil
 }
 
-func (m *MenuRepo) SumOfOrder(id string) (float64, error) {
-	for _, itemMenu := range m.menuMap {
-		if id == itemMenu.ID {
-			return itemMenu.Price, nil
+func recipeConsumption(inventory InventoryRepository, ingredients []models.MenuItemIngredient, quantity float64, plus bool, reason models.MovementReason, referenceID string) error {
+	if !plus {
+		if err := recipeCalculation(inventory, ingredients, quantity); err != nil {
+			return err
 		}
 	}
-	return 0, errorHandle.ItemIdExists
+
+	for _, itemIng := range ingredients {
+		amount, err := stockQuantity(inventory, itemIng, quantity)
+		if err != nil {
+			return err
+		}
+		if err := inventory.ConsumptionOfIngredients(itemIng.IngredientID, amount, plus, reason, referenceID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
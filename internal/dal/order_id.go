@@ -0,0 +1,125 @@
+package dal
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IDSequential = "sequential"
+	IDULID       = "ulid"
+	IDUUIDv7     = "uuidv7"
+)
+
+// IDGenerator выдаёт идентификаторы заказов. Restore вызывается при загрузке
+// хранилища, чтобы генератор продолжил с уже выданных номеров.
+type IDGenerator interface {
+	Next() string
+	Restore(ids []string)
+}
+
+func NewIDGenerator(strategy string) (IDGenerator, error) {
+	switch strategy {
+	case IDSequential, "":
+		return &sequentialID{last: make(map[string]int), now: time.Now}, nil
+	case IDULID:
+		return &ulidID{now: time.Now}, nil
+	case IDUUIDv7:
+		return &uuidV7ID{now: time.Now}, nil
+	}
+	return nil, fmt.Errorf("unknown order id strategy %q", strategy)
+}
+
+// sequentialID выдаёт номера вида 20261018-0042, нумерация начинается заново каждый день.
+type sequentialID struct {
+	mu   sync.Mutex
+	last map[string]int
+	now  func() time.Time
+}
+
+var sequentialPattern = regexp.MustCompile(`^(\d{8})-(\d+)$`)
+
+func (s *sequentialID) Next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := s.now().Format("20060102")
+	s.last[day]++
+	return fmt.Sprintf("%s-%04d", day, s.last[day])
+}
+
+func (s *sequentialID) Restore(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		match := sequentialPattern.FindStringSubmatch(id)
+		if match == nil {
+			continue
+		}
+		seq, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		if seq > s.last[match[1]] {
+			s.last[match[1]] = seq
+		}
+	}
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidID struct {
+	now func() time.Time
+}
+
+func (u *ulidID) Next() string {
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:8], uint64(u.now().UnixMilli())<<16)
+	_, _ = rand.Read(data[6:])
+
+	// 128 бит кодируются в 26 символов base32 по 5 бит, начиная со старших.
+	var out strings.Builder
+	hi := binary.BigEndian.Uint64(data[:8])
+	lo := binary.BigEndian.Uint64(data[8:])
+	for i := 25; i >= 0; i-- {
+		shift := uint(i * 5)
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift > 59:
+			v = lo>>shift | hi<<(64-shift)
+		default:
+			v = lo >> shift
+		}
+		out.WriteByte(crockford[v&0x1f])
+	}
+	return out.String()
+}
+
+func (u *ulidID) Restore(ids []string) {}
+
+type uuidV7ID struct {
+	now func() time.Time
+}
+
+func (u *uuidV7ID) Next() string {
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:8], uint64(u.now().UnixMilli())<<16)
+	_, _ = rand.Read(data[6:])
+	data[6] = data[6]&0x0f | 0x70
+	data[8] = data[8]&0x3f | 0x80
+
+	s := hex.EncodeToString(data[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+func (u *uuidV7ID) Restore(ids []string) {}
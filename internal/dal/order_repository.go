@@ -1,81 +1,213 @@
 package dal
 
 import (
-	"encoding/json"
-	"fmt"
+	"cmp"
 	"hot-coffee/internal/errorHandle"
 	"hot-coffee/models"
-	"io/ioutil"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
 	Directory string
 	TotalSum  uint
-	counter   int // Глобальный счётчик
-
 )
 
 type OrderRepository interface {
-	Create(order models.Order) error
+	Create(order models.Order) (models.Order, error)
 	GetAll() ([]models.Order, error)
+	Query(query OrderQuery) ([]models.Order, int, error)
 	GetItem(id string) (models.Order, error)
 	Update(order models.Order, id string) error
 	Delete(id string) error
-	UpdateStatus(id string) error
+	UpdateStatus(id string, status models.OrderStatus) (models.Order, error)
+}
+
+// OrderQuery — выборка заказов для списка: фильтры (пустые не ограничивают
+// выборку), сортировка и страница.
+type OrderQuery struct {
+	Status       []models.OrderStatus
+	CustomerName string // часть имени без учёта регистра
+	ProductID    string
+	From, To     time.Time
+	Sort         []SortField
+	Limit        int // 0 — все заказы после Offset
+	Offset       int
+}
+
+// SortField — поле сортировки; при равенстве по всем полям сохраняется
+// порядок добавления.
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// orderSort — поля сортировки заказов.
+var orderSort = map[string]func(a, b models.Order) int{
+	"order_id":      func(a, b models.Order) int { return cmp.Compare(a.ID, b.ID) },
+	"created_at":    func(a, b models.Order) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) },
+	"customer_name": func(a, b models.Order) int { return cmp.Compare(a.CustomerName, b.CustomerName) },
+	"status":        func(a, b models.Order) int { return cmp.Compare(a.Status, b.Status) },
+	"total":         func(a, b models.Order) int { return cmp.Compare(a.Total.Amount, b.Total.Amount) },
+}
+
+// OrderSortable сообщает, можно ли сортировать заказы по полю.
+func OrderSortable(field string) bool {
+	_, ok := orderSort[field]
+	return ok
+}
+
+func (q OrderQuery) matches(order models.Order) bool {
+	if len(q.Status) > 0 && !slices.Contains(q.Status, order.Status) {
+		return false
+	}
+	if q.CustomerName != "" && !strings.Contains(strings.ToLower(order.CustomerName), strings.ToLower(q.CustomerName)) {
+		return false
+	}
+	if q.ProductID != "" && !slices.ContainsFunc(order.Items, func(item models.OrderItem) bool {
+		return item.ProductID == q.ProductID
+	}) {
+		return false
+	}
+	return inRange(order.CreatedAt, q.From, q.To)
 }
 
 type OrderRepo struct {
+	mu       sync.RWMutex
 	path     string
 	orderMap []models.Order
+	ids      IDGenerator
+	journal  *Journal
+	staged   bool     // копия внутри транзакции, на диск пишет UnitOfWork
+	pending  []string // ID, изменённые внутри транзакции
+	restored bool     // загружены из .bak, нужно догнать по архиву журнала
+}
+
+// Сколько раз Create пытается получить свободный ID, прежде чем вернуть ошибку.
+const maxIDAttempts = 5
+
+func NewOrderRepository(path string, ids IDGenerator) (OrderRepository, error) {
+	return newOrderRepo(path, ids)
 }
 
-func NewOrderRepository(path string) OrderRepository {
-	existingData, err := ioutil.ReadFile(path)
+func newOrderRepo(path string, ids IDGenerator) (*OrderRepo, error) {
+	order, restored, err := readJSON[[]models.Order](path)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	var order []models.Order
-
-	if len(existingData) > 0 {
-		err = json.Unmarshal(existingData, &order)
-		if err != nil {
-			return nil
-		}
+	existing := make([]string, 0, len(order))
+	for _, item := range order {
+		existing = append(existing, item.ID)
 	}
+	ids.Restore(existing)
 
-	return &OrderRepo{path: path, orderMap: order}
+	return &OrderRepo{path: path, orderMap: order, ids: ids, restored: restored}, nil
 }
 
-func (o *OrderRepo) Create(order models.Order) error {
-	order.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
-	order.Status = "Open"
-	order.ID = GenerateOrderCode()
+func orderKey(order models.Order) string {
+	return order.ID
+}
 
-	o.orderMap = append(o.orderMap, order)
+// save сохраняет изменения заказов ids: в журнал, а без журнала — весь файл.
+// Если записать не удалось, в памяти восстанавливаются заказы old.
+func (o *OrderRepo) save(old []models.Order, ids ...string) error {
+	if o.staged {
+		o.pending = append(o.pending, ids...)
+		return nil
+	}
+	if err := o.persist(ids); err != nil {
+		o.orderMap = old
+		return err
+	}
+	return nil
+}
 
-	updatedData, err := json.MarshalIndent(o.orderMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
+func (o *OrderRepo) persist(ids []string) error {
+	if o.journal == nil {
+		return o.snapshot()
 	}
 
-	err = ioutil.WriteFile(o.path, updatedData, 0o644)
+	changes, err := collectChanges(storeOrders, o.orderMap, orderKey, ids)
 	if err != nil {
-		return errorHandle.ServerError
+		return err
 	}
+	return o.journal.Append(changes)
+}
 
-	return nil
+func (o *OrderRepo) snapshot() error {
+	return WriteJSON(o.path, o.orderMap)
+}
+
+func (o *OrderRepo) Create(order models.Order) (models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	old := append([]models.Order(nil), o.orderMap...)
+
+	order.CreatedAt = time.Now().Format(timeLayout)
+	order.Status = models.StatusReceived
+	order.StatusHistory = []models.StatusChange{{Status: order.Status, At: order.CreatedAt}}
+	order.ID = o.generateOrderCode()
+	if order.ID == "" {
+		return models.Order{}, errorHandle.IdOrder
+	}
+
+	o.orderMap = append(o.orderMap, order)
+
+	return order, o.save(old, order.ID)
 }
 
 func (o *OrderRepo) GetAll() ([]models.Order, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
 	if len(o.orderMap) == 0 {
-		return nil, errorHandle.EmptyFile
+		return nil, errorHandle.EmptyFileOrders
+	}
+	return append([]models.Order(nil), o.orderMap...), nil
+}
+
+// Query возвращает страницу заказов и число всех заказов под фильтрами.
+func (o *OrderRepo) Query(query OrderQuery) ([]models.Order, int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var result []models.Order
+	for _, order := range o.orderMap {
+		if query.matches(order) {
+			result = append(result, order)
+		}
+	}
+	slices.SortStableFunc(result, func(a, b models.Order) int {
+		for _, field := range query.Sort {
+			c := orderSort[field.Name](a, b)
+			if field.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	total := len(result)
+	if query.Offset >= total {
+		return []models.Order{}, total, nil
+	}
+	result = result[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(result) {
+		result = result[:query.Limit]
 	}
-	return o.orderMap, nil
+	return result, total, nil
 }
 
 func (o *OrderRepo) GetItem(id string) (models.Order, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
 	for _, item := range o.orderMap {
 		if item.ID == id {
 			return item, nil
@@ -85,7 +217,10 @@ func (o *OrderRepo) GetItem(id string) (models.Order, error) {
 }
 
 func (o *OrderRepo) Update(order models.Order, id string) error {
-	order.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	old := append([]models.Order(nil), o.orderMap...)
+
 	order.ID = id
 
 	for item := range o.orderMap {
@@ -94,20 +229,14 @@ func (o *OrderRepo) Update(order models.Order, id string) error {
 		}
 	}
 
-	updatedData, err := json.MarshalIndent(o.orderMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-
-	err = ioutil.WriteFile(o.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+	return o.save(old, id)
 }
 
 func (o *OrderRepo) Delete(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	old := append([]models.Order(nil), o.orderMap...)
+
 	var newOrders []models.Order
 	for _, item := range o.orderMap {
 		if item.ID != id {
@@ -116,50 +245,41 @@ func (o *OrderRepo) Delete(id string) error {
 	}
 	o.orderMap = newOrders
 
-	updatedData, err := json.MarshalIndent(o.orderMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-
-	err = ioutil.WriteFile(o.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+	return o.save(old, id)
 }
 
-func (o *OrderRepo) UpdateStatus(id string) error {
-	if exists := CheckId(id, o.orderMap); !exists {
-		return errorHandle.NotFoundID
-	}
+// UpdateStatus переводит заказ в status и запоминает время перехода.
+// Допустимость перехода проверяет сервис заказов.
+func (o *OrderRepo) UpdateStatus(id string, status models.OrderStatus) (models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	old := append([]models.Order(nil), o.orderMap...)
 
 	for item := range o.orderMap {
 		if o.orderMap[item].ID == id {
-			if o.orderMap[item].Status == "Close" {
-				return errorHandle.StatusExists
-			}
-
-			o.orderMap[item].Status = "Close"
+			order := withStatus(o.orderMap[item], status)
+			o.orderMap[item] = order
+			return order, o.save(old, id)
 		}
 	}
+	return models.Order{}, errorHandle.NotFoundID
+}
 
-	updatedData, err := json.MarshalIndent(o.orderMap, "", "  ")
-	if err != nil {
-		return errorHandle.ErrorFormatJson
-	}
-
-	err = ioutil.WriteFile(o.path, updatedData, 0o644)
-	if err != nil {
-		return errorHandle.ServerError
-	}
-
-	return nil
+func withStatus(order models.Order, status models.OrderStatus) models.Order {
+	order.Status = status
+	order.StatusHistory = append(order.StatusHistory[:len(order.StatusHistory):len(order.StatusHistory)],
+		models.StatusChange{Status: status, At: time.Now().Format(timeLayout)})
+	return order
 }
 
-func GenerateOrderCode() string {
-	counter++ // Увеличиваем счётчик
-	return fmt.Sprintf("order%d", counter)
+func (o *OrderRepo) generateOrderCode() string {
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		id := o.ids.Next()
+		if !CheckId(id, o.orderMap) {
+			return id
+		}
+	}
+	return ""
 }
 
 func CheckId(id string, orders []models.Order) bool {
@@ -0,0 +1,260 @@
+package dal
+
+import (
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+	"time"
+)
+
+type sqlInventoryRepo struct {
+	conn       sqlConn
+	onLowStock LowStockHook
+	lowStock   *[]models.InventoryItem // внутри UnitOfWork: уведомления до фиксации транзакции
+}
+
+func insertInventory(q querier, item models.InventoryItem) error {
+	data, err := encode(item)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("INSERT INTO inventory (ingredient_id, name, data) VALUES (?, ?, ?)", item.IngredientID, item.Name, data)
+	return sqlError(err)
+}
+
+func updateInventory(q querier, item models.InventoryItem, id string) error {
+	data, err := encode(item)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("UPDATE inventory SET ingredient_id = ?, name = ?, data = ? WHERE ingredient_id = ?", item.IngredientID, item.Name, data, id)
+	return sqlError(err)
+}
+
+// recordMovement записывает движение склада в той же транзакции, что и новый остаток.
+func recordMovement(q querier, item models.InventoryItem, delta float64, reason models.MovementReason, referenceID string) error {
+	if delta == 0 {
+		return nil
+	}
+	_, err := q.Exec("INSERT INTO stock_movements (ingredient_id, reason, delta, balance, reference_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		item.IngredientID, reason, delta, item.Quantity, referenceID, time.Now().Format(timeLayout))
+	return sqlError(err)
+}
+
+// notify передаёт хуку ингредиенты, опустившиеся до точки заказа, когда
+// изменение уже зафиксировано.
+func (i *sqlInventoryRepo) notify(items []models.InventoryItem) {
+	if i.lowStock != nil {
+		*i.lowStock = append(*i.lowStock, items...)
+		return
+	}
+	notifyLowStock(i.onLowStock, items)
+}
+
+func (i *sqlInventoryRepo) Create(item models.InventoryItem) error {
+	return i.conn.run(func(q querier) error {
+		found, err := exists(q, "SELECT 1 FROM inventory WHERE ingredient_id = ?", item.IngredientID)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errorHandle.ItemIdExists
+		}
+		found, err = exists(q, "SELECT 1 FROM inventory WHERE name = ?", item.Name)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errorHandle.ItemNameExists
+		}
+		if err := insertInventory(q, item); err != nil {
+			return err
+		}
+		return recordMovement(q, item, item.Quantity, models.ReasonStockCount, "")
+	})
+}
+
+func (i *sqlInventoryRepo) GetAll() ([]models.InventoryItem, error) {
+	items, err := queryAll[models.InventoryItem](i.conn.reader(), "SELECT data FROM inventory ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errorHandle.EmptyFileInventory
+	}
+	return items, nil
+}
+
+func (i *sqlInventoryRepo) GetItem(id string) (models.InventoryItem, error) {
+	item, found, err := queryOne[models.InventoryItem](i.conn.reader(), "SELECT data FROM inventory WHERE ingredient_id = ?", id)
+	if err != nil {
+		return item, err
+	}
+	if !found {
+		return item, errorHandle.NotFoundID
+	}
+	return item, nil
+}
+
+// Update сверяет версию с ifMatch в той же транзакции, что и запись.
+func (i *sqlInventoryRepo) Update(item models.InventoryItem, id, ifMatch string) error {
+	return i.conn.run(func(q querier) error {
+		found, err := exists(q, "SELECT 1 FROM inventory WHERE name = ? AND ingredient_id <> ?", item.Name, id)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errorHandle.ItemNameExists
+		}
+
+		old, found, err := queryOne[models.InventoryItem](q, "SELECT data FROM inventory WHERE ingredient_id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errorHandle.NotFoundID
+		}
+		if !models.MatchETag(ifMatch, old.ETag()) {
+			return errorHandle.PreconditionFailed
+		}
+		item.ArchivedAt = old.ArchivedAt
+		if err := updateInventory(q, item, id); err != nil {
+			return err
+		}
+		return recordMovement(q, item, item.Quantity-old.Quantity, models.ReasonStockCount, "")
+	})
+}
+
+func (i *sqlInventoryRepo) Archive(id, archivedAt, ifMatch string) error {
+	return i.conn.run(func(q querier) error {
+		item, found, err := queryOne[models.InventoryItem](q, "SELECT data FROM inventory WHERE ingredient_id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errorHandle.NotFoundID
+		}
+		if !models.MatchETag(ifMatch, item.ETag()) {
+			return errorHandle.PreconditionFailed
+		}
+		item.ArchivedAt = archivedAt
+		return updateInventory(q, item, id)
+	})
+}
+
+func (i *sqlInventoryRepo) Calculation(id string, quantity float64) bool {
+	item, err := i.GetItem(id)
+	if err != nil {
+		return false
+	}
+	return !item.Archived() && item.Quantity-quantity >= 0
+}
+
+func (i *sqlInventoryRepo) ConsumptionOfIngredients(id string, quantity float64, plus bool, reason models.MovementReason, referenceID string) error {
+	var low []models.InventoryItem
+	err := i.conn.run(func(q querier) error {
+		item, found, err := queryOne[models.InventoryItem](q, "SELECT data FROM inventory WHERE ingredient_id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			// Вернуть на склад удалённый ингредиент некуда, списать — нельзя.
+			if plus {
+				return nil
+			}
+			return errorHandle.Ingred
+		}
+
+		delta := quantity
+		if !plus {
+			if item.Quantity-quantity < 0 {
+				return errorHandle.Ingred
+			}
+			delta = -quantity
+		}
+		item.Quantity += delta
+		if err := updateInventory(q, item, id); err != nil {
+			return err
+		}
+		if crossedReorderPoint(item, delta) {
+			low = append(low, item)
+		}
+		return recordMovement(q, item, delta, reason, referenceID)
+	})
+	if err != nil {
+		return err
+	}
+	i.notify(low)
+	return nil
+}
+
+func (i *sqlInventoryRepo) GetMovements(id string, from, to time.Time) ([]models.StockMovement, error) {
+	query := "SELECT movement_id, ingredient_id, reason, delta, balance, reference_id, created_at FROM stock_movements WHERE ingredient_id = ?"
+	args := []any{id}
+	if !from.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, from.Format(timeLayout))
+	}
+	if !to.IsZero() {
+		query += " AND created_at <= ?"
+		args = append(args, to.Format(timeLayout))
+	}
+
+	rows, err := i.conn.reader().Query(query+" ORDER BY movement_id", args...)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	result := []models.StockMovement{}
+	for rows.Next() {
+		var movement models.StockMovement
+		if err := rows.Scan(&movement.ID, &movement.IngredientID, &movement.Reason, &movement.Delta, &movement.Balance, &movement.ReferenceID, &movement.CreatedAt); err != nil {
+			return nil, sqlError(err)
+		}
+		result = append(result, movement)
+	}
+	return result, sqlError(rows.Err())
+}
+
+func (i *sqlInventoryRepo) Adjust(adjustments []models.StockAdjustment) ([]models.InventoryItem, error) {
+	var result, low []models.InventoryItem
+	err := i.conn.run(func(q querier) error {
+		positions := make(map[string]int)
+		for _, adjustment := range adjustments {
+			item, found, err := queryOne[models.InventoryItem](q, "SELECT data FROM inventory WHERE ingredient_id = ?", adjustment.IngredientID)
+			if err != nil {
+				return err
+			}
+			if !found || item.Archived() {
+				return errorHandle.NotFoundID
+			}
+
+			item.Quantity += adjustment.Delta
+			if item.Quantity < 0 {
+				return errorHandle.NegativeStock
+			}
+			if err := updateInventory(q, item, item.IngredientID); err != nil {
+				return err
+			}
+			if err := recordMovement(q, item, adjustment.Delta, adjustment.Reason, adjustment.ReferenceID); err != nil {
+				return err
+			}
+			if crossedReorderPoint(item, adjustment.Delta) {
+				low = append(low, item)
+			}
+
+			if n, ok := positions[item.IngredientID]; ok {
+				result[n] = item
+			} else {
+				positions[item.IngredientID] = len(result)
+				result = append(result, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	i.notify(low)
+	return result, nil
+}
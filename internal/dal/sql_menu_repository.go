@@ -0,0 +1,136 @@
+package dal
+
+import (
+	"errors"
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+)
+
+type sqlMenuRepo struct {
+	conn sqlConn
+}
+
+func insertMenuItem(q querier, item models.MenuItem) error {
+	data, err := encode(item)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("INSERT INTO menu_items (product_id, name, data) VALUES (?, ?, ?)", item.ID, item.Name, data)
+	return sqlError(err)
+}
+
+func (m *sqlMenuRepo) Create(item models.MenuItem) error {
+	return m.conn.run(func(q querier) error {
+		found, err := exists(q, "SELECT 1 FROM menu_items WHERE product_id = ?", item.ID)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errorHandle.ItemIdExists
+		}
+		found, err = exists(q, "SELECT 1 FROM menu_items WHERE name = ?", item.Name)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errorHandle.ItemNameExists
+		}
+		return insertMenuItem(q, item)
+	})
+}
+
+func (m *sqlMenuRepo) GetAll() ([]models.MenuItem, error) {
+	items, err := queryAll[models.MenuItem](m.conn.reader(), "SELECT data FROM menu_items ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errorHandle.EmptyFile
+	}
+	return items, nil
+}
+
+func (m *sqlMenuRepo) GetItem(id string) (models.MenuItem, error) {
+	item, found, err := queryOne[models.MenuItem](m.conn.reader(), "SELECT data FROM menu_items WHERE product_id = ?", id)
+	if err != nil {
+		return item, err
+	}
+	if !found {
+		return item, errorHandle.NotFoundID
+	}
+	return item, nil
+}
+
+// Update сверяет версию с ifMatch в той же транзакции, что и запись.
+func (m *sqlMenuRepo) Update(item models.MenuItem, id, ifMatch string) error {
+	return m.conn.run(func(q querier) error {
+		found, err := exists(q, "SELECT 1 FROM menu_items WHERE name = ? AND product_id <> ?", item.Name, id)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errorHandle.ItemNameExists
+		}
+
+		old, found, err := queryOne[models.MenuItem](q, "SELECT data FROM menu_items WHERE product_id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errorHandle.NotFoundID
+		}
+		if !models.MatchETag(ifMatch, old.ETag()) {
+			return errorHandle.PreconditionFailed
+		}
+		item.ArchivedAt = old.ArchivedAt
+
+		data, err := encode(item)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec("UPDATE menu_items SET product_id = ?, name = ?, data = ? WHERE product_id = ?", item.ID, item.Name, data, id)
+		return sqlError(err)
+	})
+}
+
+func (m *sqlMenuRepo) Archive(id, archivedAt, ifMatch string) error {
+	return m.conn.run(func(q querier) error {
+		item, found, err := queryOne[models.MenuItem](q, "SELECT data FROM menu_items WHERE product_id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errorHandle.NotFoundID
+		}
+		if !models.MatchETag(ifMatch, item.ETag()) {
+			return errorHandle.PreconditionFailed
+		}
+
+		item.ArchivedAt = archivedAt
+		data, err := encode(item)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec("UPDATE menu_items SET data = ? WHERE product_id = ?", data, id)
+		return sqlError(err)
+	})
+}
+
+func (m *sqlMenuRepo) MenuConsumptionOfIngredients(inventory InventoryRepository, item models.OrderItem, plus bool, reason models.MovementReason, referenceID string) error {
+	recipe, err := orderRecipe(m, item)
+	if err != nil {
+		return err
+	}
+	return recipeConsumption(inventory, recipe, float64(item.Quantity), plus, reason, referenceID)
+}
+
+func (m *sqlMenuRepo) SumOfOrder(id string) (models.Money, error) {
+	item, err := m.GetItem(id)
+	if err != nil {
+		if errors.Is(err, errorHandle.NotFoundID) {
+			return models.Money{}, errorHandle.ItemIdExists
+		}
+		return models.Money{}, err
+	}
+	return item.Price, nil
+}
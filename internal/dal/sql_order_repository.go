@@ -0,0 +1,222 @@
+package dal
+
+import (
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+	"strings"
+	"time"
+)
+
+type sqlOrderRepo struct {
+	conn sqlConn
+	ids  IDGenerator
+}
+
+func newSQLOrderRepository(conn sqlConn, ids IDGenerator) (*sqlOrderRepo, error) {
+	rows, err := conn.db.Query("SELECT order_id FROM orders")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var existing []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing = append(existing, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	ids.Restore(existing)
+
+	return &sqlOrderRepo{conn: conn, ids: ids}, nil
+}
+
+func insertOrder(q querier, order models.Order) error {
+	data, err := encode(order)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("INSERT INTO orders (order_id, customer_name, status, created_at, data) VALUES (?, ?, ?, ?, ?)",
+		order.ID, order.CustomerName, order.Status, order.CreatedAt, data)
+	return sqlError(err)
+}
+
+func updateOrder(q querier, order models.Order) error {
+	data, err := encode(order)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("UPDATE orders SET customer_name = ?, status = ?, created_at = ?, data = ? WHERE order_id = ?",
+		order.CustomerName, order.Status, order.CreatedAt, data, order.ID)
+	return sqlError(err)
+}
+
+func (o *sqlOrderRepo) Create(order models.Order) (models.Order, error) {
+	err := o.conn.run(func(q querier) error {
+		order.CreatedAt = time.Now().Format(timeLayout)
+		order.Status = models.StatusReceived
+		order.StatusHistory = []models.StatusChange{{Status: order.Status, At: order.CreatedAt}}
+		order.ID = ""
+
+		for attempt := 0; attempt < maxIDAttempts && order.ID == ""; attempt++ {
+			id := o.ids.Next()
+			found, err := exists(q, "SELECT 1 FROM orders WHERE order_id = ?", id)
+			if err != nil {
+				return err
+			}
+			if !found {
+				order.ID = id
+			}
+		}
+		if order.ID == "" {
+			return errorHandle.IdOrder
+		}
+
+		return insertOrder(q, order)
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+func (o *sqlOrderRepo) GetAll() ([]models.Order, error) {
+	orders, err := queryAll[models.Order](o.conn.reader(), "SELECT data FROM orders ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errorHandle.EmptyFileOrders
+	}
+	return orders, nil
+}
+
+// orderColumns — поля сортировки заказов в SQL. Сумма заказа хранится только
+// в data, как строка "3.50".
+var orderColumns = map[string]string{
+	"order_id":      "order_id",
+	"created_at":    "created_at",
+	"customer_name": "customer_name",
+	"status":        "status",
+	"total":         "CAST(json_extract(data, '$.total.amount') AS REAL)",
+}
+
+// Query фильтрует, сортирует и режет страницу в самом запросе, чтобы фильтры
+// по статусу и времени шли по индексам idx_orders_status и idx_orders_created_at.
+func (o *sqlOrderRepo) Query(query OrderQuery) ([]models.Order, int, error) {
+	var where []string
+	var args []any
+	if len(query.Status) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(query.Status)-1)+")")
+		for _, status := range query.Status {
+			args = append(args, status)
+		}
+	}
+	if !query.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.From.Format(timeLayout))
+	}
+	if !query.To.IsZero() {
+		where = append(where, "created_at <= ?")
+		args = append(args, query.To.Format(timeLayout))
+	}
+	if query.CustomerName != "" {
+		where = append(where, "instr(lower(customer_name), lower(?)) > 0")
+		args = append(args, query.CustomerName)
+	}
+	if query.ProductID != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM json_each(data, '$.items') WHERE json_extract(value, '$.product_id') = ?)")
+		args = append(args, query.ProductID)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	order := " ORDER BY "
+	for _, field := range query.Sort {
+		column, ok := orderColumns[field.Name]
+		if !ok {
+			continue
+		}
+		order += column
+		if field.Desc {
+			order += " DESC"
+		}
+		order += ", "
+	}
+	order += "rowid"
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1 // без ограничения
+	}
+	// Счётчик и страница читаются из одного снимка базы.
+	var orders []models.Order
+	var total int
+	err := o.conn.read(func(q querier) error {
+		if err := q.QueryRow("SELECT COUNT(*) FROM orders"+filter, args...).Scan(&total); err != nil {
+			return sqlError(err)
+		}
+		var err error
+		orders, err = queryAll[models.Order](q, "SELECT data FROM orders"+filter+order+" LIMIT ? OFFSET ?", append(args, limit, query.Offset)...)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	return orders, total, nil
+}
+
+func (o *sqlOrderRepo) GetItem(id string) (models.Order, error) {
+	order, found, err := queryOne[models.Order](o.conn.reader(), "SELECT data FROM orders WHERE order_id = ?", id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !found {
+		return models.Order{}, errorHandle.NotFoundID
+	}
+	return order, nil
+}
+
+func (o *sqlOrderRepo) Update(order models.Order, id string) error {
+	order.ID = id
+
+	return o.conn.run(func(q querier) error {
+		return updateOrder(q, order)
+	})
+}
+
+func (o *sqlOrderRepo) Delete(id string) error {
+	return o.conn.run(func(q querier) error {
+		_, err := q.Exec("DELETE FROM orders WHERE order_id = ?", id)
+		return sqlError(err)
+	})
+}
+
+func (o *sqlOrderRepo) UpdateStatus(id string, status models.OrderStatus) (models.Order, error) {
+	var order models.Order
+	err := o.conn.run(func(q querier) error {
+		current, found, err := queryOne[models.Order](q, "SELECT data FROM orders WHERE order_id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errorHandle.NotFoundID
+		}
+
+		order = withStatus(current, status)
+		return updateOrder(q, order)
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
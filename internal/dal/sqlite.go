@@ -0,0 +1,313 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+	"log/slog"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// Каждая таблица хранит полную запись в data (JSON) и отдельные колонки
+// для поиска и индексов. Порядок выдачи совпадает с порядком вставки (rowid).
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS inventory (
+	ingredient_id TEXT PRIMARY KEY,
+	name          TEXT NOT NULL,
+	data          TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS menu_items (
+	product_id TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS orders (
+	order_id      TEXT PRIMARY KEY,
+	customer_name TEXT NOT NULL,
+	status        TEXT NOT NULL,
+	created_at    TEXT NOT NULL,
+	data          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE TABLE IF NOT EXISTS stock_movements (
+	movement_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+	ingredient_id TEXT NOT NULL,
+	reason        TEXT NOT NULL,
+	delta         REAL NOT NULL,
+	balance       REAL NOT NULL,
+	reference_id  TEXT NOT NULL DEFAULT '',
+	created_at    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_ingredient ON stock_movements(ingredient_id, created_at);
+`
+
+// sqliteMigrations переводят данные старых версий. Номер последней
+// применённой миграции хранится в PRAGMA user_version, поэтому каждая
+// выполняется один раз; новые добавляются только в конец.
+var sqliteMigrations = []string{
+	// 1: статусы заказов, созданных до появления жизненного цикла.
+	`UPDATE orders SET status = 'received' WHERE status = 'Open';
+UPDATE orders SET status = 'picked_up' WHERE status = 'Close';`,
+}
+
+// querier — общее подмножество *sql.DB и *sql.Tx.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sqlConn — соединение репозитория: вне транзакции каждая операция
+// открывает свою, внутри UnitOfWork используется общая tx.
+type sqlConn struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (c sqlConn) run(fn func(q querier) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return sqlError(err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return sqlError(tx.Commit())
+}
+
+// read выполняет несколько чтений в одной транзакции только для чтения:
+// она не берёт блокировку записи, но видит один снимок базы.
+func (c sqlConn) read(fn func(q querier) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+
+	tx, err := c.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return sqlError(err)
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+func (c sqlConn) reader() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.db
+}
+
+func openSQLiteDB(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	return sqlConn{db: db}.run(func(q querier) error {
+		var version int
+		if err := q.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			return sqlError(err)
+		}
+		if version >= len(sqliteMigrations) {
+			return nil
+		}
+		for n := version; n < len(sqliteMigrations); n++ {
+			if _, err := q.Exec(sqliteMigrations[n]); err != nil {
+				return sqlError(err)
+			}
+			slog.Info("SQLite migration applied", "version", n+1)
+		}
+		// PRAGMA не принимает параметры запроса.
+		_, err := q.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(sqliteMigrations)))
+		return sqlError(err)
+	})
+}
+
+func openSQLite(cfg Config) (*Store, error) {
+	db, err := openSQLiteDB(filepath.Join(cfg.Dir, sqliteFile))
+	if err != nil {
+		return nil, err
+	}
+
+	conn := sqlConn{db: db}
+	orderRepo, err := newSQLOrderRepository(conn, cfg.OrderIDs)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{
+		Inventory:  &sqlInventoryRepo{conn: conn, onLowStock: cfg.LowStock},
+		Menu:       &sqlMenuRepo{conn: conn},
+		Orders:     orderRepo,
+		UnitOfWork: &sqlUnitOfWork{db: db, ids: cfg.OrderIDs, onLowStock: cfg.LowStock},
+		close:      db.Close,
+	}, nil
+}
+
+func seedSQLite(path string, data Dataset) error {
+	db, err := openSQLiteDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return sqlConn{db: db}.run(func(q querier) error {
+		for _, table := range []string{"inventory", "menu_items", "orders", "stock_movements"} {
+			if _, err := q.Exec("DELETE FROM " + table); err != nil {
+				return sqlError(err)
+			}
+		}
+		for _, item := range data.Inventory {
+			if err := insertInventory(q, item); err != nil {
+				return err
+			}
+			if err := recordMovement(q, item, item.Quantity, models.ReasonStockCount, ""); err != nil {
+				return err
+			}
+		}
+		for _, item := range data.Menu {
+			if err := insertMenuItem(q, item); err != nil {
+				return err
+			}
+		}
+		for _, order := range data.Orders {
+			if err := insertOrder(q, order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type sqlUnitOfWork struct {
+	db         *sql.DB
+	ids        IDGenerator
+	onLowStock LowStockHook
+}
+
+type sqlTx struct {
+	inventory *sqlInventoryRepo
+	orders    *sqlOrderRepo
+}
+
+func (u *sqlUnitOfWork) Do(fn func(tx Tx) error) error {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return sqlError(err)
+	}
+
+	var low []models.InventoryItem
+	conn := sqlConn{db: u.db, tx: tx}
+	if err := fn(&sqlTx{inventory: &sqlInventoryRepo{conn: conn, lowStock: &low}, orders: &sqlOrderRepo{conn: conn, ids: u.ids}}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return sqlError(err)
+	}
+	notifyLowStock(u.onLowStock, low)
+	return nil
+}
+
+func (t *sqlTx) Inventory() InventoryRepository {
+	return t.inventory
+}
+
+func (t *sqlTx) Orders() OrderRepository {
+	return t.orders
+}
+
+// queryAll читает колонку data из всех строк запроса.
+func queryAll[T any](q querier, query string, args ...any) ([]T, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	var result []T
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, sqlError(err)
+		}
+		var item T
+		if err := json.Unmarshal([]byte(raw), &item); err != nil {
+			return nil, sqlError(err)
+		}
+		result = append(result, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqlError(err)
+	}
+	return result, nil
+}
+
+// queryOne возвращает found=false, если строки нет.
+func queryOne[T any](q querier, query string, args ...any) (T, bool, error) {
+	var item T
+	var raw string
+	err := q.QueryRow(query, args...).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return item, false, nil
+	}
+	if err != nil {
+		return item, false, sqlError(err)
+	}
+	if err := json.Unmarshal([]byte(raw), &item); err != nil {
+		return item, false, sqlError(err)
+	}
+	return item, true, nil
+}
+
+func exists(q querier, query string, args ...any) (bool, error) {
+	var one int
+	err := q.QueryRow(query, args...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, sqlError(err)
+	}
+	return true, nil
+}
+
+func encode(v any) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", sqlError(err)
+	}
+	return string(raw), nil
+}
+
+func sqlError(err error) error {
+	if err == nil {
+		return nil
+	}
+	slog.Error("Database error", slog.String("error", err.Error()))
+	return errorHandle.ServerError
+}
@@ -0,0 +1,149 @@
+package dal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/errorHandle"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const backupSuffix = ".bak"
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// inRange проверяет, что отметка времени в формате timeLayout попадает
+// в [from, to]; нулевая граница не ограничивает.
+func inRange(createdAt string, from, to time.Time) bool {
+	if !from.IsZero() && createdAt < from.Format(timeLayout) {
+		return false
+	}
+	if !to.IsZero() && createdAt > to.Format(timeLayout) {
+		return false
+	}
+	return true
+}
+
+// readJSON загружает файл хранилища. Если основной файл отсутствует или
+// повреждён, загружается предыдущее поколение из .bak и restored = true:
+// данные отстают от последнего снимка, и догнать их — дело вызывающего.
+// Основной файл не переписывается, пока состояние не восстановлено целиком.
+func readJSON[T any](path string) (data T, restored bool, err error) {
+	data, err = decodeFile[T](path)
+	if err == nil {
+		return data, false, nil
+	}
+
+	backup, backupErr := decodeFile[T](path + backupSuffix)
+	if backupErr != nil {
+		var zero T
+		return zero, false, fmt.Errorf("load %s: %w", path, err)
+	}
+
+	slog.Warn("Data file is damaged, falling back to the previous generation",
+		slog.String("path", path), slog.String("error", err.Error()))
+	return backup, true, nil
+}
+
+func decodeFile[T any](path string) (T, error) {
+	var data T
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return data, err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return data, nil
+	}
+	err = json.Unmarshal(raw, &data)
+	return data, err
+}
+
+// WriteJSON атомарно сохраняет v в path, оставляя прошлую версию в .bak.
+func WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errorHandle.ErrorFormatJson
+	}
+
+	if err := writeFileAtomic(path, data, true); err != nil {
+		slog.Error("Failed to write data file", slog.String("path", path), slog.String("error", err.Error()))
+		return errorHandle.ServerError
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, keepBackup bool) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, 0o644); err != nil {
+		return err
+	}
+
+	if keepBackup {
+		if err := rotateBackup(path); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rotateBackup сохраняет текущее поколение файла как .bak, не удаляя сам файл,
+// чтобы в любой момент на диске была хотя бы одна целая версия.
+func rotateBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	backup := path + backupSuffix
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(backup, raw, false)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// Не все файловые системы поддерживают fsync каталога.
+	_ = d.Sync()
+	return nil
+}
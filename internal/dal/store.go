@@ -0,0 +1,231 @@
+package dal
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"log/slog"
+	"path/filepath"
+)
+
+const (
+	StorageJSON   = "json"
+	StorageSQLite = "sqlite"
+)
+
+const sqliteFile = "hot-coffee.db"
+
+// Store объединяет репозитории одного хранилища.
+type Store struct {
+	Inventory  InventoryRepository
+	Menu       MenuRepository
+	Orders     OrderRepository
+	UnitOfWork UnitOfWork
+	close      func() error
+}
+
+type Config struct {
+	Storage  string
+	Dir      string
+	OrderIDs IDGenerator
+	LowStock LowStockHook
+}
+
+// Dataset — полный набор данных для начального заполнения хранилища.
+type Dataset struct {
+	Inventory []models.InventoryItem `json:"inventory"`
+	Menu      []models.MenuItem      `json:"menu"`
+	Orders    []models.Order         `json:"orders"`
+}
+
+var jsonFiles = []string{"inventory.json", "menu_items.json", "orders.json"}
+
+func Open(cfg Config) (*Store, error) {
+	switch cfg.Storage {
+	case StorageJSON, "":
+		return openJSON(cfg)
+	case StorageSQLite:
+		return openSQLite(cfg)
+	}
+	return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+func (s *Store) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// Seed заменяет содержимое хранилища набором data.
+func Seed(cfg Config, data Dataset) error {
+	switch cfg.Storage {
+	case StorageJSON, "":
+		return seedJSON(cfg.Dir, data)
+	case StorageSQLite:
+		return seedSQLite(filepath.Join(cfg.Dir, sqliteFile), data)
+	}
+	return fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+func openJSON(cfg Config) (*Store, error) {
+	inventoryRepo, err := newInventoryRepo(filepath.Join(cfg.Dir, "inventory.json"))
+	if err != nil {
+		return nil, err
+	}
+	menuRepo, err := NewMenuRepository(filepath.Join(cfg.Dir, "menu_items.json"))
+	if err != nil {
+		return nil, err
+	}
+	orderRepo, err := newOrderRepo(filepath.Join(cfg.Dir, "orders.json"), cfg.OrderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	journal, entries, err := openJournal(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	restored := inventoryRepo.restored || orderRepo.restored
+	if restored {
+		if entries, err = recoverJournal(cfg.Dir, entries); err != nil {
+			journal.Close()
+			return nil, err
+		}
+	}
+	if err := replayJournal(entries, inventoryRepo, orderRepo); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	inventoryRepo.journal = journal
+	inventoryRepo.onLowStock = cfg.LowStock
+	orderRepo.journal = journal
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		runCompaction(journal, inventoryRepo, orderRepo, done)
+	}()
+	// После загрузки из .bak снимки переписываются, даже если журнал пуст.
+	if len(entries) > 0 || restored {
+		journal.compact <- struct{}{}
+	}
+
+	return &Store{
+		Inventory:  inventoryRepo,
+		Menu:       menuRepo,
+		Orders:     orderRepo,
+		UnitOfWork: &unitOfWork{inventory: inventoryRepo, orders: orderRepo},
+		// Журнал закрывается только после того, как сжатие остановилось.
+		close: func() error {
+			close(done)
+			<-stopped
+			return journal.Close()
+		},
+	}, nil
+}
+
+func replayJournal(entries []journalEntry, inventory *inventoryRepo, orders *OrderRepo) error {
+	var orderIDs []string
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			var err error
+			switch change.Store {
+			case storeInventory:
+				inventory.inventoryMap, err = applyChange(inventory.inventoryMap, inventoryKey, change)
+			case storeMovements:
+				inventory.movements, err = applyChange(inventory.movements, movementKey, change)
+			case storeOrders:
+				orders.orderMap, err = applyChange(orders.orderMap, orderKey, change)
+				orderIDs = append(orderIDs, change.ID)
+			default:
+				err = fmt.Errorf("unknown journal store %q", change.Store)
+			}
+			if err != nil {
+				return fmt.Errorf("replay journal entry %d: %w", entry.Seq, err)
+			}
+		}
+	}
+	orders.ids.Restore(orderIDs)
+
+	if len(entries) > 0 {
+		slog.Info("Journal replayed", slog.Int("entries", len(entries)))
+	}
+	return nil
+}
+
+func runCompaction(journal *Journal, inventory *inventoryRepo, orders *OrderRepo, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-journal.compact:
+			if err := compactJSON(journal, inventory, orders); err != nil {
+				slog.Error("Journal compaction failed", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// compactJSON записывает снимки и архивирует журнал. Пока удерживаются
+// блокировки чтения, ни один репозиторий не может дописать журнал.
+func compactJSON(journal *Journal, inventory *inventoryRepo, orders *OrderRepo) error {
+	inventory.mu.RLock()
+	defer inventory.mu.RUnlock()
+	orders.mu.RLock()
+	defer orders.mu.RUnlock()
+
+	if err := inventory.snapshot(); err != nil {
+		return err
+	}
+	if err := orders.snapshot(); err != nil {
+		return err
+	}
+	if err := writeSnapshotSeq(journal.dir, journal.Seq()); err != nil {
+		return err
+	}
+	return journal.rotate()
+}
+
+func seedJSON(dir string, data Dataset) error {
+	if err := archiveJournal(dir); err != nil {
+		return err
+	}
+
+	stores := map[string]any{
+		"inventory.json":  nonNil(data.Inventory),
+		"menu_items.json": nonNil(data.Menu),
+		"orders.json":     nonNil(data.Orders),
+	}
+	for _, name := range jsonFiles {
+		if err := WriteJSON(filepath.Join(dir, name), stores[name]); err != nil {
+			return err
+		}
+	}
+	// Архив до заполнения к новым данным не относится.
+	if err := writeSnapshotSeq(dir, lastArchivedSeq(filepath.Join(dir, journalArchive))); err != nil {
+		return err
+	}
+
+	// Начальные остатки попадают в журнал склада как инвентаризация.
+	seeded := &inventoryRepo{}
+	for _, item := range data.Inventory {
+		seeded.record(item, item.Quantity, models.ReasonStockCount, "")
+	}
+	return WriteJSON(filepath.Join(dir, movementsFile), nonNil(seeded.movements))
+}
+
+// JSONFiles возвращает пути файлов JSON-хранилища в каталоге dir.
+func JSONFiles(dir string) []string {
+	paths := make([]string, 0, len(jsonFiles))
+	for _, name := range jsonFiles {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,587 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Набор тестов проверяет, что хранилища JSON и SQLite ведут себя одинаково.
+
+var backends = []struct {
+	name    string
+	storage string
+}{
+	{"json", StorageJSON},
+	{"sqlite", StorageSQLite},
+}
+
+func testDataset() Dataset {
+	return Dataset{
+		Inventory: []models.InventoryItem{
+			{IngredientID: "milk", Name: "Milk", Quantity: 1000, Unit: "ml"},
+			{IngredientID: "beans", Name: "Coffee beans", Quantity: 500, Unit: "g"},
+		},
+		Menu: []models.MenuItem{
+			{
+				ID:          "latte",
+				Name:        "Latte",
+				Description: "Espresso with milk",
+				Price:       models.Money{Amount: 350, Currency: models.DefaultCurrency},
+				Category:    models.CategoryHotDrinks,
+				Ingredients: []models.MenuItemIngredient{
+					{IngredientID: "beans", Quantity: 18, Unit: "g"},
+					{IngredientID: "milk", Quantity: 0.2, Unit: "l"},
+				},
+			},
+		},
+	}
+}
+
+func testConfig(t *testing.T, storage, dir string) Config {
+	t.Helper()
+	ids, err := NewIDGenerator(IDSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Config{Storage: storage, Dir: dir, OrderIDs: ids}
+}
+
+// openTestStore заполняет временный каталог testDataset и открывает хранилище.
+func openTestStore(t *testing.T, storage string) *Store {
+	t.Helper()
+	dir := t.TempDir()
+	if err := Seed(testConfig(t, storage, dir), testDataset()); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(testConfig(t, storage, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func testOrder(name string) models.Order {
+	return models.Order{
+		CustomerName: name,
+		Items: []models.OrderItem{{
+			ProductID: "latte",
+			Quantity:  1,
+			Recipe:    []models.MenuItemIngredient{{IngredientID: "milk", Quantity: 200, Unit: "ml"}},
+		}},
+	}
+}
+
+func quantity(t *testing.T, inventory InventoryRepository, id string) float64 {
+	t.Helper()
+	item, err := inventory.GetItem(id)
+	if err != nil {
+		t.Fatalf("GetItem(%q): %v", id, err)
+	}
+	return item.Quantity
+}
+
+func TestInventory(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, inventory InventoryRepository)
+	}{
+		{"create and get", func(t *testing.T, inventory InventoryRepository) {
+			sugar := models.InventoryItem{IngredientID: "sugar", Name: "Sugar", Quantity: 300, Unit: "g"}
+			if err := inventory.Create(sugar); err != nil {
+				t.Fatal(err)
+			}
+			if err := inventory.Create(sugar); !errors.Is(err, errorHandle.ItemIdExists) {
+				t.Errorf("duplicate ID: got %v, want %v", err, errorHandle.ItemIdExists)
+			}
+			sugar.IngredientID = "sugar2"
+			if err := inventory.Create(sugar); !errors.Is(err, errorHandle.ItemNameExists) {
+				t.Errorf("duplicate name: got %v, want %v", err, errorHandle.ItemNameExists)
+			}
+
+			items, err := inventory.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 3 {
+				t.Errorf("GetAll: got %d items, want 3", len(items))
+			}
+			if got := quantity(t, inventory, "sugar"); got != 300 {
+				t.Errorf("quantity: got %v, want 300", got)
+			}
+			if _, err := inventory.GetItem("salt"); !errors.Is(err, errorHandle.NotFoundID) {
+				t.Errorf("GetItem unknown: got %v, want %v", err, errorHandle.NotFoundID)
+			}
+		}},
+		{"update", func(t *testing.T, inventory InventoryRepository) {
+			milk, err := inventory.GetItem("milk")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tag := milk.ETag()
+			milk.Quantity = 800
+			if err := inventory.Update(milk, "milk", `"stale"`); !errors.Is(err, errorHandle.PreconditionFailed) {
+				t.Errorf("stale If-Match: got %v, want %v", err, errorHandle.PreconditionFailed)
+			}
+			if err := inventory.Update(milk, "milk", tag); err != nil {
+				t.Fatal(err)
+			}
+			if got := quantity(t, inventory, "milk"); got != 800 {
+				t.Errorf("quantity: got %v, want 800", got)
+			}
+
+			milk.Name = "Coffee beans"
+			if err := inventory.Update(milk, "milk", ""); !errors.Is(err, errorHandle.ItemNameExists) {
+				t.Errorf("taken name: got %v, want %v", err, errorHandle.ItemNameExists)
+			}
+			if err := inventory.Update(models.InventoryItem{IngredientID: "salt", Name: "Salt", Unit: "g"}, "salt", ""); !errors.Is(err, errorHandle.NotFoundID) {
+				t.Errorf("unknown item: got %v, want %v", err, errorHandle.NotFoundID)
+			}
+		}},
+		{"archive", func(t *testing.T, inventory InventoryRepository) {
+			if err := inventory.Archive("beans", "2024-01-15 10:00:00", `"stale"`); !errors.Is(err, errorHandle.PreconditionFailed) {
+				t.Errorf("stale If-Match: got %v, want %v", err, errorHandle.PreconditionFailed)
+			}
+			if err := inventory.Archive("beans", "2024-01-15 10:00:00", ""); err != nil {
+				t.Fatal(err)
+			}
+			beans, err := inventory.GetItem("beans")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !beans.Archived() {
+				t.Error("beans are not archived")
+			}
+			if inventory.Calculation("beans", 1) {
+				t.Error("archived ingredient is still available")
+			}
+
+			// Update не снимает архивную пометку.
+			beans.ArchivedAt = ""
+			if err := inventory.Update(beans, "beans", ""); err != nil {
+				t.Fatal(err)
+			}
+			if beans, _ = inventory.GetItem("beans"); !beans.Archived() {
+				t.Error("Update restored an archived ingredient")
+			}
+			if err := inventory.Archive("salt", "", ""); !errors.Is(err, errorHandle.NotFoundID) {
+				t.Errorf("unknown item: got %v, want %v", err, errorHandle.NotFoundID)
+			}
+		}},
+		{"adjust", func(t *testing.T, inventory InventoryRepository) {
+			items, err := inventory.Adjust([]models.StockAdjustment{
+				{IngredientID: "milk", Delta: 250, Reason: models.ReasonDelivery, ReferenceID: "INV-1"},
+				{IngredientID: "beans", Delta: -100, Reason: models.ReasonWaste},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 2 || items[0].Quantity != 1250 || items[1].Quantity != 400 {
+				t.Errorf("Adjust returned %+v", items)
+			}
+
+			// Если хоть один остаток уйдёт ниже нуля, не меняется ничего.
+			_, err = inventory.Adjust([]models.StockAdjustment{
+				{IngredientID: "milk", Delta: 100, Reason: models.ReasonDelivery},
+				{IngredientID: "beans", Delta: -1000, Reason: models.ReasonWaste},
+			})
+			if !errors.Is(err, errorHandle.NegativeStock) {
+				t.Errorf("negative balance: got %v, want %v", err, errorHandle.NegativeStock)
+			}
+			if got := quantity(t, inventory, "milk"); got != 1250 {
+				t.Errorf("milk after rejected adjust: got %v, want 1250", got)
+			}
+			if _, err := inventory.Adjust([]models.StockAdjustment{{IngredientID: "salt", Delta: 1, Reason: models.ReasonDelivery}}); !errors.Is(err, errorHandle.NotFoundID) {
+				t.Errorf("unknown item: got %v, want %v", err, errorHandle.NotFoundID)
+			}
+
+			movements, err := inventory.GetMovements("milk", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := movements[len(movements)-1]
+			if last.Delta != 250 || last.Balance != 1250 || last.Reason != models.ReasonDelivery || last.ReferenceID != "INV-1" {
+				t.Errorf("last movement: %+v", last)
+			}
+		}},
+		{"adjust archived", func(t *testing.T, inventory InventoryRepository) {
+			if err := inventory.Archive("beans", "2024-01-15 10:00:00", ""); err != nil {
+				t.Fatal(err)
+			}
+			_, err := inventory.Adjust([]models.StockAdjustment{
+				{IngredientID: "milk", Delta: 100, Reason: models.ReasonDelivery},
+				{IngredientID: "beans", Delta: 100, Reason: models.ReasonDelivery},
+			})
+			if !errors.Is(err, errorHandle.NotFoundID) {
+				t.Errorf("archived item: got %v, want %v", err, errorHandle.NotFoundID)
+			}
+			if got := quantity(t, inventory, "milk"); got != 1000 {
+				t.Errorf("milk after rejected adjust: got %v, want 1000", got)
+			}
+			if got := quantity(t, inventory, "beans"); got != 500 {
+				t.Errorf("beans after rejected adjust: got %v, want 500", got)
+			}
+		}},
+		{"consumption", func(t *testing.T, inventory InventoryRepository) {
+			if err := inventory.ConsumptionOfIngredients("milk", 300, false, models.ReasonOrderConsumption, "order-1"); err != nil {
+				t.Fatal(err)
+			}
+			if got := quantity(t, inventory, "milk"); got != 700 {
+				t.Errorf("after consumption: got %v, want 700", got)
+			}
+			if err := inventory.ConsumptionOfIngredients("milk", 1000, false, models.ReasonOrderConsumption, "order-2"); !errors.Is(err, errorHandle.Ingred) {
+				t.Errorf("insufficient stock: got %v, want %v", err, errorHandle.Ingred)
+			}
+			if err := inventory.ConsumptionOfIngredients("milk", 300, true, models.ReasonOrderCancellation, "order-1"); err != nil {
+				t.Fatal(err)
+			}
+			if got := quantity(t, inventory, "milk"); got != 1000 {
+				t.Errorf("after refund: got %v, want 1000", got)
+			}
+
+			movements, err := inventory.GetMovements("milk", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(movements) != 3 {
+				t.Fatalf("got %d movements, want 3: %+v", len(movements), movements)
+			}
+			if movements[1].Delta != -300 || movements[2].Delta != 300 || movements[2].Reason != models.ReasonOrderCancellation {
+				t.Errorf("movements: %+v", movements)
+			}
+		}},
+	}
+
+	for _, backend := range backends {
+		for _, test := range tests {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := openTestStore(t, backend.storage)
+				test.run(t, store.Inventory)
+			})
+		}
+	}
+}
+
+func TestMenu(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := openTestStore(t, backend.storage)
+			menu := store.Menu
+
+			mocha := testDataset().Menu[0]
+			mocha.ID, mocha.Name = "mocha", "Mocha"
+			if err := menu.Create(mocha); err != nil {
+				t.Fatal(err)
+			}
+			if err := menu.Create(mocha); !errors.Is(err, errorHandle.ItemIdExists) {
+				t.Errorf("duplicate ID: got %v, want %v", err, errorHandle.ItemIdExists)
+			}
+			items, err := menu.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 2 {
+				t.Errorf("GetAll: got %d items, want 2", len(items))
+			}
+
+			stored, err := menu.GetItem("mocha")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored.Price.Amount = 420
+			if err := menu.Update(stored, "mocha", `"stale"`); !errors.Is(err, errorHandle.PreconditionFailed) {
+				t.Errorf("stale If-Match: got %v, want %v", err, errorHandle.PreconditionFailed)
+			}
+			if err := menu.Update(stored, "mocha", stored.ETag()); !errors.Is(err, errorHandle.PreconditionFailed) {
+				t.Errorf("If-Match of the changed item: got %v, want %v", err, errorHandle.PreconditionFailed)
+			}
+			if err := menu.Update(stored, "mocha", ""); err != nil {
+				t.Fatal(err)
+			}
+			if price, err := menu.SumOfOrder("mocha"); err != nil || price.Amount != 420 {
+				t.Errorf("price after update: got %v, %v", price, err)
+			}
+
+			if err := menu.Archive("mocha", "2024-01-15 10:00:00", ""); err != nil {
+				t.Fatal(err)
+			}
+			if stored, _ = menu.GetItem("mocha"); !stored.Archived() {
+				t.Error("mocha is not archived")
+			}
+			if err := menu.Archive("mocha", "", stored.ETag()); err != nil {
+				t.Fatal(err)
+			}
+			if stored, _ = menu.GetItem("mocha"); stored.Archived() {
+				t.Error("mocha is still archived")
+			}
+		})
+	}
+}
+
+func TestOrders(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := openTestStore(t, backend.storage)
+			orders := store.Orders
+
+			if _, err := orders.GetAll(); !errors.Is(err, errorHandle.EmptyFileOrders) {
+				t.Errorf("GetAll on empty store: got %v, want %v", err, errorHandle.EmptyFileOrders)
+			}
+
+			ann, err := orders.Create(testOrder("Ann"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ann.ID == "" || ann.Status != models.StatusReceived || ann.CreatedAt == "" {
+				t.Errorf("created order: %+v", ann)
+			}
+			bob, err := orders.Create(testOrder("Bob"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bob.ID == ann.ID {
+				t.Errorf("both orders got ID %s", ann.ID)
+			}
+
+			ann.Items[0].Quantity = 2
+			if err := orders.Update(ann, ann.ID); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := orders.GetItem(ann.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Items[0].Quantity != 2 || len(stored.Items[0].Recipe) != 1 {
+				t.Errorf("updated order: %+v", stored)
+			}
+
+			if _, err := orders.UpdateStatus(bob.ID, models.StatusCancelled); err != nil {
+				t.Fatal(err)
+			}
+			list, total, err := orders.Query(OrderQuery{Status: []models.OrderStatus{models.StatusCancelled}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 1 || len(list) != 1 || list[0].ID != bob.ID {
+				t.Errorf("cancelled orders: total %d, %+v", total, list)
+			}
+			list, total, err = orders.Query(OrderQuery{Sort: []SortField{{Name: "customer_name", Desc: true}}, Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 2 || len(list) != 1 || list[0].CustomerName != "Bob" {
+				t.Errorf("first page sorted by name: total %d, %+v", total, list)
+			}
+
+			if err := orders.Delete(ann.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := orders.GetItem(ann.ID); !errors.Is(err, errorHandle.NotFoundID) {
+				t.Errorf("deleted order: got %v, want %v", err, errorHandle.NotFoundID)
+			}
+		})
+	}
+}
+
+// TestJSONBackupRecovery повреждает orders.json после двух сжатий: снимок из
+// .bak отстаёт на одно сжатие, и недостающий заказ берётся из архива журнала.
+func TestJSONBackupRecovery(t *testing.T) {
+	dir := t.TempDir()
+	if err := Seed(testConfig(t, StorageJSON, dir), testDataset()); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(testConfig(t, StorageJSON, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, inventory := store.Orders.(*OrderRepo), store.Inventory.(*inventoryRepo)
+	var ids []string
+	for n := 0; n < 3; n++ {
+		order, err := store.Orders.Create(testOrder("Ann"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, order.ID)
+		if n < 2 {
+			if err := compactJSON(orders.journal, inventory, orders); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "orders.json"), []byte("[{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Без архива второго сжатия догнать .bak нечем: запуск прерывается.
+	archived := filepath.Join(dir, journalArchive, fmt.Sprintf("journal-%012d.jsonl", 2))
+	if err := os.Rename(archived, archived+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(testConfig(t, StorageJSON, dir)); err == nil {
+		t.Fatal("Open succeeded with a gap in the journal archive")
+	}
+	if err := os.Rename(archived+".moved", archived); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(testConfig(t, StorageJSON, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for _, id := range ids {
+		if _, err := reopened.Orders.GetItem(id); err != nil {
+			t.Errorf("order %s after recovery: %v", id, err)
+		}
+	}
+}
+
+func TestUnitOfWorkRollback(t *testing.T) {
+	errAbort := errors.New("abort")
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := openTestStore(t, backend.storage)
+			before, err := store.Inventory.GetMovements("milk", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.UnitOfWork.Do(func(tx Tx) error {
+				order, err := tx.Orders().Create(testOrder("Ann"))
+				if err != nil {
+					return err
+				}
+				if err := tx.Inventory().ConsumptionOfIngredients("milk", 200, false, models.ReasonOrderConsumption, order.ID); err != nil {
+					return err
+				}
+				if got := quantity(t, tx.Inventory(), "milk"); got != 800 {
+					t.Errorf("milk inside the transaction: got %v, want 800", got)
+				}
+				return errAbort
+			})
+			if !errors.Is(err, errAbort) {
+				t.Fatalf("Do: got %v, want %v", err, errAbort)
+			}
+
+			if got := quantity(t, store.Inventory, "milk"); got != 1000 {
+				t.Errorf("milk after rollback: got %v, want 1000", got)
+			}
+			after, err := store.Inventory.GetMovements("milk", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(after) != len(before) {
+				t.Errorf("movements after rollback: got %d, want %d", len(after), len(before))
+			}
+			if _, err := store.Orders.GetAll(); !errors.Is(err, errorHandle.EmptyFileOrders) {
+				t.Errorf("orders after rollback: got %v, want %v", err, errorHandle.EmptyFileOrders)
+			}
+		})
+	}
+}
+
+// TestOrderIDRestore проверяет, что после перезапуска генератор продолжает
+// с выданных номеров: иначе Create исчерпает попытки на занятых ID.
+func TestOrderIDRestore(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := Seed(testConfig(t, backend.storage, dir), testDataset()); err != nil {
+				t.Fatal(err)
+			}
+			store, err := Open(testConfig(t, backend.storage, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			issued := make(map[string]bool)
+			for n := 0; n < maxIDAttempts+1; n++ {
+				order, err := store.Orders.Create(testOrder("Ann"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				issued[order.ID] = true
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened, err := Open(testConfig(t, backend.storage, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+
+			order, err := reopened.Orders.Create(testOrder("Bob"))
+			if err != nil {
+				t.Fatalf("Create after restart: %v", err)
+			}
+			if issued[order.ID] {
+				t.Errorf("ID %s was issued again", order.ID)
+			}
+			all, err := reopened.Orders.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != len(issued)+1 {
+				t.Errorf("got %d orders after restart, want %d", len(all), len(issued)+1)
+			}
+		})
+	}
+}
+
+// TestSQLiteMigrations проверяет, что миграция статусов выполняется один
+// раз: заказ со статусом "Open", записанный после неё, остаётся как есть.
+func TestSQLiteMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqliteFile)
+	// exec открывает базу (с миграциями) и выполняет запросы.
+	exec := func(queries ...string) {
+		t.Helper()
+		db, err := openSQLiteDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		for _, query := range queries {
+			if _, err := db.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	insert := func(id string) string {
+		return "INSERT INTO orders (order_id, customer_name, status, created_at, data) VALUES ('" + id + "', 'Ann', 'Open', '2024-01-15 10:00:00', '{}')"
+	}
+	// База старой версии: user_version ещё 0.
+	exec(insert("old"), "PRAGMA user_version = 0")
+	exec(insert("new"))
+
+	db, err := openSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(sqliteMigrations) {
+		t.Errorf("user_version = %d, want %d", version, len(sqliteMigrations))
+	}
+	for id, want := range map[string]string{"old": "received", "new": "Open"} {
+		var status string
+		if err := db.QueryRow("SELECT status FROM orders WHERE order_id = ?", id).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status != want {
+			t.Errorf("%s: status %q, want %q", id, status, want)
+		}
+	}
+}
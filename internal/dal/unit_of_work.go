@@ -0,0 +1,109 @@
+package dal
+
+import (
+	"errors"
+	"hot-coffee/models"
+	"log/slog"
+)
+
+// UnitOfWork выполняет изменения склада и заказов как одно целое:
+// либо применяются все изменения из fn, либо ни одного.
+type UnitOfWork interface {
+	Do(fn func(tx Tx) error) error
+}
+
+type Tx interface {
+	Inventory() InventoryRepository
+	Orders() OrderRepository
+}
+
+type unitOfWork struct {
+	inventory *inventoryRepo
+	orders    *OrderRepo
+}
+
+type jsonTx struct {
+	inventory *inventoryRepo
+	orders    *OrderRepo
+}
+
+func NewUnitOfWork(inventory InventoryRepository, orders OrderRepository) (UnitOfWork, error) {
+	inventoryRepos, ok := inventory.(*inventoryRepo)
+	if !ok {
+		return nil, errors.New("unit of work: unsupported inventory repository")
+	}
+	orderRepos, ok := orders.(*OrderRepo)
+	if !ok {
+		return nil, errors.New("unit of work: unsupported order repository")
+	}
+	return &unitOfWork{inventory: inventoryRepos, orders: orderRepos}, nil
+}
+
+func (u *unitOfWork) Do(fn func(tx Tx) error) error {
+	// Порядок захвата блокировок всегда: склад, затем заказы.
+	u.inventory.mu.Lock()
+	defer u.inventory.mu.Unlock()
+	u.orders.mu.Lock()
+	defer u.orders.mu.Unlock()
+
+	tx := &jsonTx{
+		inventory: &inventoryRepo{
+			inventoryMap: append([]models.InventoryItem(nil), u.inventory.inventoryMap...),
+			movements:    u.inventory.movements[:len(u.inventory.movements):len(u.inventory.movements)],
+			staged:       true,
+		},
+		orders: &OrderRepo{
+			orderMap: append([]models.Order(nil), u.orders.orderMap...),
+			ids:      u.orders.ids,
+			staged:   true,
+		},
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	oldInventory, oldMovements, oldOrders := u.inventory.inventoryMap, u.inventory.movements, u.orders.orderMap
+	u.inventory.inventoryMap, u.inventory.movements, u.orders.orderMap = tx.inventory.inventoryMap, tx.inventory.movements, tx.orders.orderMap
+
+	if err := u.commit(tx, oldInventory, oldMovements); err != nil {
+		u.inventory.inventoryMap, u.inventory.movements, u.orders.orderMap = oldInventory, oldMovements, oldOrders
+		return err
+	}
+	notifyLowStock(u.inventory.onLowStock, tx.inventory.lowStock)
+	return nil
+}
+
+func (u *unitOfWork) commit(tx *jsonTx, oldInventory []models.InventoryItem, oldMovements []models.StockMovement) error {
+	if u.inventory.journal != nil {
+		inventoryChanges, err := tx.inventory.changes(tx.inventory.pending)
+		if err != nil {
+			return err
+		}
+		orderChanges, err := collectChanges(storeOrders, tx.orders.orderMap, orderKey, tx.orders.pending)
+		if err != nil {
+			return err
+		}
+		return u.inventory.journal.Append(append(inventoryChanges, orderChanges...))
+	}
+
+	if err := u.inventory.snapshot(); err != nil {
+		return err
+	}
+	if err := u.orders.snapshot(); err != nil {
+		u.inventory.inventoryMap, u.inventory.movements = oldInventory, oldMovements
+		if rollbackErr := u.inventory.snapshot(); rollbackErr != nil {
+			slog.Error("Failed to roll back inventory", slog.String("error", rollbackErr.Error()))
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *jsonTx) Inventory() InventoryRepository {
+	return t.inventory
+}
+
+func (t *jsonTx) Orders() OrderRepository {
+	return t.orders
+}
@@ -1,35 +1,105 @@
 package errorHandle
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+)
+
+// Error — ошибка предметной области: стабильный код для клиентов, HTTP-статус,
+// сообщение и необязательные подробности.
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	Details []Detail
+}
+
+// Detail уточняет ошибку: поле запроса или зависимая запись.
+type Detail struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Type    string `json:"type,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func New(code string, status int, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is сравнивает ошибки по коду, поэтому копия с подробностями остаётся той же ошибкой.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails возвращает копию ошибки с подробностями.
+func (e *Error) WithDetails(details ...Detail) *Error {
+	copied := *e
+	copied.Details = append(append([]Detail(nil), e.Details...), details...)
+	return &copied
+}
 
 var (
-	ItemNameExists     = errors.New("Item with this name alredy exists")
-	ItemIdExists       = errors.New("Item with this ID alredy exists")
-	ServerError        = errors.New("Error in server")
-	ErrorFormatJson    = errors.New("Invalid format JSON")
-	EmptyFile          = errors.New("Menu has not items")
-	NotFoundID         = errors.New("Item with this ID does not exists ")
-	ChangeID           = errors.New("You can't change ID item")
-	PriceLessZero      = errors.New("Price is less than zero")
-	QuantityLessZero   = errors.New("Quantity is less than zero")
-	IdOrder            = errors.New("ID already exists")
-	EmptyFileInventory = errors.New("Inventory has not items")
-	OrderID            = errors.New("ID already exists")
-	Ingred             = errors.New("Ingredients are missing")
-	ChangeName         = errors.New("You can't update the name of customer")
-	StatusExists       = errors.New("Status already close")
-	DeleteOrder        = errors.New("You can't delete the order")
+	ErrorFormatJson     = New("invalid_json", http.StatusBadRequest, "Invalid format JSON")
+	ChangeID            = New("id_immutable", http.StatusBadRequest, "You can't change ID item")
+	ChangeName          = New("customer_immutable", http.StatusBadRequest, "You can't update the name of customer")
+	QuantityLessZero    = New("invalid_quantity", http.StatusBadRequest, "Quantity is less than zero")
+	InvalidDateRange    = New("invalid_date_range", http.StatusBadRequest, "Invalid date range")
+	InvalidReason       = New("invalid_reason", http.StatusBadRequest, "Invalid movement reason")
+	UnknownUnit         = New("unknown_unit", http.StatusBadRequest, "Unknown unit of measure")
+	UnitMismatch        = New("unit_mismatch", http.StatusBadRequest, "Recipe unit can't be converted to stock unit")
+	UnknownCurrency     = New("unknown_currency", http.StatusBadRequest, "Unknown currency")
+	CurrencyMismatch    = New("currency_mismatch", http.StatusBadRequest, "Amounts in different currencies")
+	AmountOverflow      = New("amount_overflow", http.StatusBadRequest, "Amount is too large")
+	InvalidStatus       = New("invalid_status", http.StatusBadRequest, "Unknown order status")
+	InvalidOption       = New("invalid_option", http.StatusBadRequest, "Unknown variant or modifier")
+	InvalidCategory     = New("invalid_category", http.StatusBadRequest, "Unknown menu category")
+	InvalidAvailability = New("invalid_availability", http.StatusBadRequest, "Invalid availability window")
+	UnknownIngredient   = New("unknown_ingredient", http.StatusBadRequest, "Recipe references an unknown ingredient")
+	NotPrepared         = New("not_prepared", http.StatusBadRequest, "Ingredient has no recipe")
+	RecipeCycle         = New("recipe_cycle", http.StatusBadRequest, "Recipe refers to itself")
+	ValidationFailed    = New("validation_failed", http.StatusBadRequest, "Request has invalid fields")
+	InvalidPatch        = New("invalid_patch", http.StatusBadRequest, "Invalid patch document")
+
+	NotFoundID         = New("not_found", http.StatusNotFound, "Item with this ID does not exists")
+	EmptyFile          = New("menu_empty", http.StatusNotFound, "Menu has not items")
+	EmptyFileInventory = New("inventory_empty", http.StatusNotFound, "Inventory has not items")
+	EmptyFileOrders    = New("orders_empty", http.StatusNotFound, "There are no orders")
+
+	MethodNotAllowed = New("method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed")
+
+	PreconditionFailed = New("precondition_failed", http.StatusPreconditionFailed, "Item has been changed since it was read")
+
+	UnsupportedMediaType = New("unsupported_media_type", http.StatusUnsupportedMediaType, "Unsupported patch format")
+
+	ItemNameExists    = New("name_exists", http.StatusConflict, "Item with this name alredy exists")
+	ItemIdExists      = New("id_exists", http.StatusConflict, "Item with this ID alredy exists")
+	IdOrder           = New("order_id_exists", http.StatusConflict, "Order with this ID already exists")
+	StatusExists      = New("order_closed", http.StatusConflict, "Status already close")
+	DeleteOrder       = New("order_not_deletable", http.StatusConflict, "You can't delete the order")
+	InvalidTransition = New("invalid_transition", http.StatusConflict, "Order can't move to this status")
+	OrderLocked       = New("order_locked", http.StatusConflict, "Order can't be changed in its current status")
+	NotAvailable      = New("not_available", http.StatusConflict, "Item is not available at this time")
+	NotArchived       = New("not_archived", http.StatusConflict, "Item is not archived")
+	PatchTestFailed   = New("patch_test_failed", http.StatusConflict, "Patch test operation failed")
+	HasDependents     = New("has_dependents", http.StatusConflict, "Item is still referenced, use ?force=true to archive it")
+
+	Ingred        = New("insufficient_stock", http.StatusUnprocessableEntity, "Ingredients are missing")
+	NegativeStock = New("negative_stock", http.StatusUnprocessableEntity, "Stock can't go below zero")
+
+	ServerError = New("internal", http.StatusInternalServerError, "Error in server")
 )
 
-func CheckErrors(e error) int {
-	if e == IdOrder || e == ItemNameExists || e == ItemIdExists || e == ErrorFormatJson || e == ChangeID || e == PriceLessZero || e == QuantityLessZero {
-		return 400
-	}
-	if e == ServerError {
-		return 500
-	}
-	if e == NotFoundID || e == EmptyFile || e == EmptyFileInventory {
-		return 404
+// As находит *Error в цепочке err; любая другая ошибка считается внутренней.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
 	}
-	return 500
+	return ServerError
 }
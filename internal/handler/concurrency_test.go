@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentOrdersAndInventory одновременно оформляет заказы с молоком и
+// принимает поставки молока, как касса и склад в утренний час пик: ни одно
+// списание или поступление не должно потеряться, журнал движений должен
+// сходиться с остатком, а номера заказов — не повторяться.
+func TestConcurrentOrdersAndInventory(t *testing.T) {
+	const (
+		orders     = 40
+		deliveries = 20
+		shots      = 100
+		milk       = 5000
+		perLatte   = 100
+		delivery   = 50
+	)
+
+	for _, storage := range []string{dal.StorageJSON, dal.StorageSQLite} {
+		t.Run(storage, func(t *testing.T) {
+			store := openStore(t, storage, dal.Dataset{
+				Inventory: []models.InventoryItem{
+					{IngredientID: "espresso_shot", Name: "Espresso shot", Quantity: shots, Unit: "shots"},
+					{IngredientID: "milk", Name: "Milk", Quantity: milk, Unit: "ml"},
+				},
+				Menu: []models.MenuItem{{
+					ID:          "latte",
+					Name:        "Latte",
+					Description: "Espresso with milk",
+					Price:       models.Money{Amount: 350, Currency: models.DefaultCurrency},
+					Category:    models.CategoryHotDrinks,
+					Ingredients: []models.MenuItemIngredient{
+						{IngredientID: "espresso_shot", Quantity: 1},
+						{IngredientID: "milk", Quantity: perLatte, Unit: "ml"},
+					},
+				}},
+			})
+
+			orderHandler := NewOrderHandler(service.NewOrderService(store.Orders, store.Menu, store.Inventory, store.UnitOfWork))
+			inventoryHandler := NewInventoryHandler(service.NewInventoryService(store.Inventory, store.Menu))
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /orders", orderHandler.CreateOrder)
+			mux.HandleFunc("GET /orders", orderHandler.GetAllOrders)
+			mux.HandleFunc("POST /inventory/{id}/adjust", inventoryHandler.AdjustInventory)
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, orders+deliveries)
+			for n := 0; n < orders; n++ {
+				wg.Add(1)
+				go func(n int) {
+					defer wg.Done()
+					order := fmt.Sprintf(`{"customer_name": "Till %d", "items": [{"product_id": "latte", "quantity": 1}]}`, n%2+1)
+					errs <- send(server.URL, http.MethodPost, "/orders", order)
+				}(n)
+			}
+			for n := 0; n < deliveries; n++ {
+				wg.Add(1)
+				go func(n int) {
+					defer wg.Done()
+					adjustment := fmt.Sprintf(`{"delta": %d, "reason": "delivery", "reference_id": "INV-%d"}`, delivery, n)
+					errs <- send(server.URL, http.MethodPost, "/inventory/milk/adjust", adjustment)
+				}(n)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Error(err)
+				}
+			}
+
+			want := map[string]float64{
+				"espresso_shot": shots - orders,
+				"milk":          milk + deliveries*delivery - orders*perLatte,
+			}
+			for id, quantity := range want {
+				item, err := store.Inventory.GetItem(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if item.Quantity != quantity {
+					t.Errorf("%s: got %v, want %v", id, item.Quantity, quantity)
+				}
+			}
+
+			// Начальная инвентаризация, списание на каждый заказ и каждая поставка.
+			movements, err := store.Inventory.GetMovements("milk", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(movements) != 1+orders+deliveries {
+				t.Errorf("got %d milk movements, want %d", len(movements), 1+orders+deliveries)
+			}
+			var sum float64
+			for _, movement := range movements {
+				sum += movement.Delta
+			}
+			if sum != want["milk"] {
+				t.Errorf("milk movements add up to %v, want %v", sum, want["milk"])
+			}
+			if last := movements[len(movements)-1]; last.Balance != want["milk"] {
+				t.Errorf("last milk balance %v, want %v", last.Balance, want["milk"])
+			}
+
+			resp, err := http.Get(server.URL + "/orders?limit=200&fields=order_id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var list struct {
+				Orders []models.Order `json:"orders"`
+				Total  int            `json:"total"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+				t.Fatal(err)
+			}
+			if list.Total != orders {
+				t.Errorf("got %d orders, want %d", list.Total, orders)
+			}
+			seen := make(map[string]bool, len(list.Orders))
+			for _, order := range list.Orders {
+				if seen[order.ID] {
+					t.Errorf("order ID %s was issued twice", order.ID)
+				}
+				seen[order.ID] = true
+			}
+		})
+	}
+}
+
+func openStore(t *testing.T, storage string, data dal.Dataset) *dal.Store {
+	t.Helper()
+	ids, err := dal.NewIDGenerator(dal.IDSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := dal.Config{Storage: storage, Dir: t.TempDir(), OrderIDs: ids}
+	if err := dal.Seed(cfg, data); err != nil {
+		t.Fatal(err)
+	}
+	store, err := dal.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func send(url, method, path, body string) error {
+	req, err := http.NewRequest(method, url+path, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var payload bytes.Buffer
+		payload.ReadFrom(resp.Body)
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, payload.String())
+	}
+	return nil
+}
@@ -1,13 +1,21 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hot-coffee/internal/errorHandle"
+	"hot-coffee/internal/patch"
 	"hot-coffee/internal/service"
+	"hot-coffee/internal/validate"
 	"hot-coffee/models"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type InventoryHandler struct {
@@ -23,11 +31,11 @@ func NewInventoryHandler(service service.InventoryService) *InventoryHandler {
 func (h *InventoryHandler) CreateNewInventory(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Request CreateNewInventory")
 	var inventory models.InventoryItem
-	err := json.NewDecoder(r.Body).Decode(&inventory)
+	err := decodeJSON(r, &inventory)
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
@@ -35,7 +43,7 @@ func (h *InventoryHandler) CreateNewInventory(w http.ResponseWriter, r *http.Req
 
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
@@ -45,22 +53,46 @@ func (h *InventoryHandler) CreateNewInventory(w http.ResponseWriter, r *http.Req
 func (h *InventoryHandler) GetAllInventory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 	if r.URL.Path != "/inventory" {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 	slog.Info("Request GetAllInventory")
-	allInventory, err := h.service.GetAll()
+	includeArchived, err := boolQuery(r, "include_archived")
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
-	JsonWriterListInventory(w, 200, allInventory, nil, nil, nil)
+	page, err := listQuery(r)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	filter := service.InventoryFilter{
+		Name:            r.URL.Query().Get("name"),
+		IncludeArchived: includeArchived,
+		ListQuery:       page,
+	}
+
+	list, err := h.service.GetAll(filter)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	items, err := selectFields(r, list.Items)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	JsonWriterData(w, 200, ListResponse{Inventory: items, Total: list.Total, Limit: page.Limit, Offset: page.Offset})
 }
 
 func (h *InventoryHandler) GetItemInventory(w http.ResponseWriter, r *http.Request) {
@@ -70,7 +102,10 @@ func (h *InventoryHandler) GetItemInventory(w http.ResponseWriter, r *http.Reque
 	item, err := h.service.GetItem(id)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
+		return
+	}
+	if notModified(w, r, item.ETag()) {
 		return
 	}
 	JsonWriterItemForInventory(w, 200, &item, nil, nil, nil)
@@ -82,54 +117,311 @@ func (h *InventoryHandler) UpdateInventory(w http.ResponseWriter, r *http.Reques
 	id := r.PathValue("id")
 	w.Header().Set("Content-Type", "application/json")
 
-	err := json.NewDecoder(r.Body).Decode(&newInventory)
+	err := decodeJSON(r, &newInventory)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
-	err = h.service.Update(newInventory, id)
+	err = h.service.Update(newInventory, id, r.Header.Get("If-Match"))
 
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
 	JsonWriter(w, 201, "Item updated successfully", nil)
 }
 
+func (h *InventoryHandler) PatchInventory(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request PatchInventory")
+	id := r.PathValue("id")
+
+	current, err := h.service.GetItem(id)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	// Патч строится по прочитанной версии, поэтому запись сохраняется, только
+	// если с тех пор её никто не изменил.
+	tag := current.ETag()
+	if !models.MatchETag(r.Header.Get("If-Match"), tag) {
+		slog.Warn(errorHandle.PreconditionFailed.Error())
+		JsonError(w, errorHandle.PreconditionFailed)
+		return
+	}
+	var item models.InventoryItem
+	if err := patchJSON(w, r, current, &item); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	if err := h.service.Update(item, id, tag); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	JsonWriter(w, 200, "Item updated successfully", nil)
+}
+
 func (h *InventoryHandler) DeleteInventory(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Request DeleteInventory")
 	id := r.PathValue("id")
 	w.Header().Set("Content-Type", "application/json")
 
-	err := h.service.Delete(id)
+	force, err := boolQuery(r, "force")
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
+		return
+	}
+	err = h.service.Delete(id, force, r.Header.Get("If-Match"))
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
 		return
 	}
 
 	JsonWriter(w, 200, "Item deleted successfully", nil)
 }
 
-func JsonWriter(w http.ResponseWriter, statusCode int, message string, err error) {
+func (h *InventoryHandler) RestoreInventory(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request RestoreInventory")
+	id := r.PathValue("id")
+
+	if err := h.service.Restore(id); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriter(w, 200, "Item restored successfully", nil)
+}
+
+func (h *InventoryHandler) GetMovements(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request GetMovements")
+	id := r.PathValue("id")
+	query := r.URL.Query()
+
+	movements, err := h.service.GetMovements(id, query.Get("from"), query.Get("to"))
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriterData(w, 200, MovementsResponse{IngredientID: id, Movements: movements})
+}
+
+func (h *InventoryHandler) AdjustInventory(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request AdjustInventory")
+	id := r.PathValue("id")
+
+	var adjustment models.StockAdjustment
+	if err := decodeJSON(r, &adjustment); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	item, err := h.service.Adjust(id, adjustment)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", item.ETag())
+	JsonWriterItemForInventory(w, 200, &item, nil, nil, nil)
+}
+
+func (h *InventoryHandler) ProduceInventory(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request ProduceInventory")
+	id := r.PathValue("id")
+
+	// Пустое тело — одна партия по рецепту.
+	var production models.Production
+	if err := decodeBody(r, &production); err != nil && err != io.EOF {
+		slog.Warn(err.Error())
+		JsonError(w, decodeError(err))
+		return
+	}
+
+	item, err := h.service.Produce(id, production)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", item.ETag())
+	JsonWriterItemForInventory(w, 200, &item, nil, nil, nil)
+}
+
+func (h *InventoryHandler) RestockInventory(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request RestockInventory")
+
+	var restock models.Restock
+	if err := decodeJSON(r, &restock); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	items, err := h.service.Restock(restock)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriterListInventory(w, 200, items, nil, nil, nil)
+}
+
+func (h *InventoryHandler) GetLowStock(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request GetLowStock")
+
+	items, err := h.service.LowStock()
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriterData(w, 200, LowStockResponse{LowStock: items})
+}
+
+// decodeBody читает тело запроса в v и отклоняет неизвестные поля.
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	return decodeError(decodeBody(r, v))
+}
+
+// acceptPatch перечисляет форматы PATCH для заголовка Accept-Patch.
+var acceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+// patchJSON накладывает тело запроса PATCH на текущую запись и разбирает
+// результат в v так же строго, как тело PUT. Обычный application/json
+// считается merge patch.
+func patchJSON(w http.ResponseWriter, r *http.Request, current, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errorHandle.ErrorFormatJson
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case patch.MergePatchType, "application/json":
+		patched, err = patch.Merge(doc, body)
+	case patch.JSONPatchType:
+		patched, err = patch.Apply(doc, body)
+	default:
+		w.Header().Set("Accept-Patch", acceptPatch)
+		return errorHandle.UnsupportedMediaType
+	}
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	return decodeError(decoder.Decode(v))
+}
+
+// decodeError сохраняет ошибки предметной области из UnmarshalJSON (валюта,
+// статус заказа), неизвестные поля и поля не того типа описывает подробно,
+// остальные ошибки разбора означают неверный JSON.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *errorHandle.Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return errorHandle.ValidationFailed.WithDetails(errorHandle.Detail{
+			Field:   typeErr.Field,
+			Code:    validate.CodeInvalidType,
+			Message: "must not be a " + typeErr.Value,
+		})
+	}
+	// encoding/json не экспортирует тип этой ошибки.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return errorHandle.ValidationFailed.WithDetails(errorHandle.Detail{
+			Field:   strings.Trim(field, `"`),
+			Code:    validate.CodeUnknownField,
+			Message: "is not a known field",
+		})
+	}
+	return errorHandle.ErrorFormatJson
+}
+
+// notModified ставит заголовок ETag и отвечает 304, если версия из
+// If-None-Match совпадает с текущей.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" || !models.MatchETag(ifNoneMatch, tag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// boolQuery читает необязательный логический параметр запроса.
+func boolQuery(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errorHandle.ErrorFormatJson
+	}
+	return result, nil
+}
+
+// JsonError пишет ошибку в едином формате; статус и код берутся из ошибки.
+// Внутренние подробности неизвестных ошибок клиенту не отдаются.
+func JsonError(w http.ResponseWriter, err error) {
+	e := errorHandle.As(err)
+	if !errors.Is(err, e) {
+		slog.Error("Unexpected error", slog.String("error", err.Error()))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	resp := Response{Error: e.Message, Code: e.Code, Details: e.Details}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Error encoding JSON", slog.String("error", err.Error()))
+	}
+}
 
-	resp := Response{}
+func JsonWriter(w http.ResponseWriter, statusCode int, message string, err error) {
 	if err != nil {
-		statusCode = errorHandle.CheckErrors(err)
-		resp.Error = err.Error()
-		w.WriteHeader(statusCode)
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			http.Error(w, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
-		}
+		JsonError(w, err)
 		return
 	}
 
-	resp.Message = message
+	w.Header().Set("Content-Type", "application/json")
+	resp := Response{Message: message}
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
@@ -137,21 +429,11 @@ func JsonWriter(w http.ResponseWriter, statusCode int, message string, err error
 }
 
 func JsonWriterListInventory(w http.ResponseWriter, statusCode int, listInventory []models.InventoryItem, listMenu []models.MenuItem, listOrders []models.Order, err error) {
-	w.Header().Set("Content-Type", "application/json")
-
 	if err != nil {
-		statusCode = errorHandle.CheckErrors(err)
-		resp := Response{
-			Error: err.Error(),
-		}
-
-		w.WriteHeader(statusCode)
-
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			http.Error(w, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
-		}
+		JsonError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	resp := GetListItems{}
 
 	if listInventory != nil {
@@ -169,19 +451,11 @@ func JsonWriterListInventory(w http.ResponseWriter, statusCode int, listInventor
 }
 
 func JsonWriterItemForInventory(w http.ResponseWriter, statusCode int, itemInventory *models.InventoryItem, itemMenu *models.MenuItem, itemOrders *models.Order, err error) {
-	w.Header().Set("Content-Type", "application/json")
-
 	if err != nil {
-		statusCode = errorHandle.CheckErrors(err)
-		resp := Response{
-			Error: err.Error(),
-		}
-		w.WriteHeader(statusCode)
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			http.Error(w, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
-		}
+		JsonError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 
 	resp := GetItems{}
 
@@ -199,12 +473,21 @@ func JsonWriterItemForInventory(w http.ResponseWriter, statusCode int, itemInven
 	}
 }
 
-func TotalSalesAndPopularItemResponse(w http.ResponseWriter, statusCode int, sum float64, popularItem string) {
+// JsonWriterData отдаёт произвольный ответ без обёртки Response.
+func JsonWriterData(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func TotalSalesAndPopularItemResponse(w http.ResponseWriter, statusCode int, sum *models.Money, popularItem string) {
 	w.Header().Set("Content-Type", "application/json")
 
 	resp := Response{}
 
-	if sum == 0 {
+	if sum == nil {
 		resp.PopularItem = popularItem
 	} else {
 		resp.TotalSales = sum
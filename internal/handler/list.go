@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/service"
+	"hot-coffee/internal/validate"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// ListResponse — страница списка: записи под именем ресурса, число всех
+// записей, подходящих под фильтры, и границы страницы.
+type ListResponse struct {
+	Menu      any `json:"menu,omitempty"`
+	Inventory any `json:"inventory,omitempty"`
+	Orders    any `json:"orders,omitempty"`
+	Total     int `json:"total"`
+	Limit     int `json:"limit"`
+	Offset    int `json:"offset"`
+}
+
+// listQuery читает из строки запроса сортировку и страницу.
+func listQuery(r *http.Request) (service.ListQuery, error) {
+	query := r.URL.Query()
+	result := service.ListQuery{Sort: query.Get("sort"), Limit: defaultLimit}
+
+	var v validate.Errors
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			v.Add("limit", validate.CodeOutOfRange, fmt.Sprintf("must be a number from 1 to %d", maxLimit))
+		}
+		result.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			v.Add("offset", validate.CodeOutOfRange, "must be a number not less than 0")
+		}
+		result.Offset = offset
+	}
+	return result, v.Err()
+}
+
+// listParam разбирает параметр со списком значений через запятую.
+func listParam(r *http.Request, name string) []string {
+	var values []string
+	for _, value := range strings.Split(r.URL.Query().Get(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// selectFields оставляет в записях только поля из параметра fields; без
+// него записи возвращаются целиком.
+func selectFields[T any](r *http.Request, items []T) (any, error) {
+	names := listParam(r, "fields")
+	if len(names) == 0 {
+		return items, nil
+	}
+
+	known := jsonFields(reflect.TypeFor[T]())
+	var v validate.Errors
+	for _, name := range names {
+		if !known[name] {
+			v.Add("fields", validate.CodeInvalid, "unknown field "+name)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]json.RawMessage, len(items))
+	for n, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		result[n] = make(map[string]json.RawMessage, len(names))
+		for _, name := range names {
+			if value, ok := fields[name]; ok {
+				result[n][name] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// jsonFields собирает имена полей структуры в JSON.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
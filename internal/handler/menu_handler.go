@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"encoding/json"
+	"hot-coffee/internal/errorHandle"
 	"hot-coffee/internal/service"
 	"hot-coffee/models"
 	"log/slog"
@@ -9,10 +9,12 @@ import (
 )
 
 type Response struct {
-	Error       string  `json:"error,omitempty"`
-	Message     string  `json:"message,omitempty"`
-	TotalSales  float64 `json:"total_sales,omitempty"`
-	PopularItem string  `json:"popular_item,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Code        string               `json:"code,omitempty"`
+	Details     []errorHandle.Detail `json:"details,omitempty"`
+	Message     string               `json:"message,omitempty"`
+	TotalSales  *models.Money        `json:"total_sales,omitempty"`
+	PopularItem string               `json:"popular_item,omitempty"`
 }
 
 type GetListItems struct {
@@ -27,6 +29,19 @@ type GetItems struct {
 	ItemOrders    *models.Order         `json:"Item_Orders,omitempty"`
 }
 
+type MovementsResponse struct {
+	IngredientID string                 `json:"ingredient_id"`
+	Movements    []models.StockMovement `json:"movements"`
+}
+
+type LowStockResponse struct {
+	LowStock []models.LowStockItem `json:"low_stock"`
+}
+
+type MenuAvailabilityResponse struct {
+	Items []models.MenuStock `json:"items"`
+}
+
 type MenuHandler struct {
 	service service.MenuService
 }
@@ -40,11 +55,11 @@ func NewMenuHandler(service service.MenuService) *MenuHandler {
 func (h *MenuHandler) CreateNewMenu(w http.ResponseWriter, r *http.Request) {
 	var menu models.MenuItem
 	slog.Info("Request CreateNewMenu")
-	err := json.NewDecoder(r.Body).Decode(&menu)
+	err := decodeJSON(r, &menu)
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
@@ -52,7 +67,7 @@ func (h *MenuHandler) CreateNewMenu(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
@@ -62,23 +77,57 @@ func (h *MenuHandler) CreateNewMenu(w http.ResponseWriter, r *http.Request) {
 func (h *MenuHandler) GetAllMenu(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 	if r.URL.Path != "/menu" {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 	slog.Info("Request GetAllMenu")
-	allMenuItems, err := h.service.GetAll()
+	query := r.URL.Query()
+	availableNow, err := boolQuery(r, "available_now")
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	includeArchived, err := boolQuery(r, "include_archived")
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	page, err := listQuery(r)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
+	filter := service.MenuFilter{
+		Category:        models.Category(query.Get("category")),
+		Tag:             query.Get("tag"),
+		Name:            query.Get("name"),
+		AvailableNow:    availableNow,
+		IncludeArchived: includeArchived,
+		ListQuery:       page,
+	}
 
-	JsonWriterListInventory(w, 200, nil, allMenuItems, nil, nil)
+	list, err := h.service.GetAll(filter)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	items, err := selectFields(r, list.Items)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriterData(w, 200, ListResponse{Menu: items, Total: list.Total, Limit: page.Limit, Offset: page.Offset})
 }
 
 func (h *MenuHandler) GetItemMenu(w http.ResponseWriter, r *http.Request) {
@@ -88,7 +137,10 @@ func (h *MenuHandler) GetItemMenu(w http.ResponseWriter, r *http.Request) {
 	result, err := h.service.GetItem(id)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
+		return
+	}
+	if notModified(w, r, result.ETag()) {
 		return
 	}
 	JsonWriterItemForInventory(w, 200, nil, &result, nil, nil)
@@ -100,33 +152,97 @@ func (h *MenuHandler) UpdateMenu(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	w.Header().Set("Content-Type", "application/json")
 
-	err := json.NewDecoder(r.Body).Decode(&newMenu)
+	err := decodeJSON(r, &newMenu)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
-	err = h.service.Update(newMenu, id)
+	err = h.service.Update(newMenu, id, r.Header.Get("If-Match"))
 
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
 	JsonWriter(w, 201, "Item updated successfully", nil)
 }
 
+func (h *MenuHandler) PatchMenu(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request PatchMenu")
+	id := r.PathValue("id")
+
+	current, err := h.service.GetItem(id)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	// Патч строится по прочитанной версии, поэтому запись сохраняется, только
+	// если с тех пор её никто не изменил.
+	tag := current.ETag()
+	if !models.MatchETag(r.Header.Get("If-Match"), tag) {
+		slog.Warn(errorHandle.PreconditionFailed.Error())
+		JsonError(w, errorHandle.PreconditionFailed)
+		return
+	}
+	var item models.MenuItem
+	if err := patchJSON(w, r, current, &item); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	if err := h.service.Update(item, id, tag); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	JsonWriter(w, 200, "Item updated successfully", nil)
+}
+
 func (h *MenuHandler) DeleteItemFromMenu(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Request DeleteItemFromMenu")
 	w.Header().Set("Content-Type", "application/json")
 	id := r.PathValue("id")
-	err := h.service.Delete(id)
+	force, err := boolQuery(r, "force")
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	err = h.service.Delete(id, force, r.Header.Get("If-Match"))
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 	JsonWriter(w, 200, "Item deleted successfully", nil)
 }
+
+func (h *MenuHandler) RestoreMenu(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request RestoreMenu")
+	id := r.PathValue("id")
+
+	if err := h.service.Restore(id); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriter(w, 200, "Item restored successfully", nil)
+}
+
+func (h *MenuHandler) GetMenuAvailability(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request GetMenuAvailability")
+	items, err := h.service.Availability()
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	JsonWriterData(w, 200, MenuAvailabilityResponse{Items: items})
+}
@@ -1,13 +1,17 @@
 package handler
 
 import (
-	"encoding/json"
+	"hot-coffee/internal/errorHandle"
 	"hot-coffee/internal/service"
 	"hot-coffee/models"
 	"log/slog"
 	"net/http"
 )
 
+type TransitionRequest struct {
+	Status models.OrderStatus `json:"status"`
+}
+
 type OrderHandler struct {
 	service service.OrderService
 }
@@ -24,17 +28,17 @@ func (o *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 	var order models.Order
 
-	err := json.NewDecoder(r.Body).Decode(&order)
+	err := decodeJSON(r, &order)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 
 	err = o.service.Create(order)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 	JsonWriter(w, 200, "Order has been create succesful", nil)
@@ -45,24 +49,48 @@ func (o *OrderHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodGet {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 	if r.URL.Path != "/orders" {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 
 	slog.Info("Request GetAllOrders")
 
-	orders, err := o.service.GetAll()
+	page, err := listQuery(r)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	filter := service.OrderFilter{
+		CustomerName: query.Get("customer_name"),
+		ProductID:    query.Get("product_id"),
+		CreatedFrom:  query.Get("created_from"),
+		CreatedTo:    query.Get("created_to"),
+		ListQuery:    page,
+	}
+	for _, status := range listParam(r, "status") {
+		filter.Status = append(filter.Status, models.OrderStatus(status))
+	}
+
+	list, err := o.service.GetAll(filter)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+	items, err := selectFields(r, list.Items)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
-	JsonWriterListInventory(w, 200, nil, nil, orders, nil)
+	JsonWriterData(w, 200, ListResponse{Orders: items, Total: list.Total, Limit: page.Limit, Offset: page.Offset})
 }
 
 func (o *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
@@ -71,7 +99,10 @@ func (o *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	order, err := o.service.GetItem(id)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
+		return
+	}
+	if notModified(w, r, order.ETag()) {
 		return
 	}
 	JsonWriterItemForInventory(w, 200, nil, nil, &order, nil)
@@ -83,17 +114,50 @@ func (o *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 
 	var newOrder models.Order
 
-	err := json.NewDecoder(r.Body).Decode(&newOrder)
+	err := decodeJSON(r, &newOrder)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	err = o.service.Update(newOrder, id, r.Header.Get("If-Match"))
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
+	JsonWriter(w, 200, "Order has been updated succesful", nil)
+}
+
+func (o *OrderHandler) PatchOrder(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Request PatchOrder")
+	id := r.PathValue("id")
 
-	err = o.service.Update(newOrder, id)
+	current, err := o.service.GetItem(id)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
+		return
+	}
+	// Патч строится по прочитанной версии, поэтому запись сохраняется, только
+	// если с тех пор её никто не изменил.
+	tag := current.ETag()
+	if !models.MatchETag(r.Header.Get("If-Match"), tag) {
+		slog.Warn(errorHandle.PreconditionFailed.Error())
+		JsonError(w, errorHandle.PreconditionFailed)
+		return
+	}
+	var order models.Order
+	if err := patchJSON(w, r, current, &order); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	if err := o.service.Patch(order, id, tag); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
 		return
 	}
 	JsonWriter(w, 200, "Order has been updated succesful", nil)
@@ -102,10 +166,10 @@ func (o *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 func (o *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	id := r.PathValue("id")
-	err := o.service.Delete(id)
+	err := o.service.Delete(id, r.Header.Get("If-Match"))
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 	JsonWriter(w, 200, "Order has been deleted succesful", nil)
@@ -115,14 +179,14 @@ func (o *OrderHandler) StatusClose(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method != http.MethodPost {
 		slog.Warn("Method not allowed")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		JsonError(w, errorHandle.MethodNotAllowed)
 		return
 	}
 	id := r.PathValue("id")
 	err := o.service.UpdateStatus(id)
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
 	JsonWriter(w, 200, "Order has been updated succesful", nil)
@@ -133,10 +197,10 @@ func (o *OrderHandler) TotalSales(w http.ResponseWriter, r *http.Request) {
 	totalSum, err := o.service.TotalSum()
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
 		return
 	}
-	TotalSalesAndPopularItemResponse(w, 200, totalSum, "")
+	TotalSalesAndPopularItemResponse(w, 200, &totalSum, "")
 }
 
 func (o *OrderHandler) TheMostPopularItem(w http.ResponseWriter, r *http.Request) {
@@ -144,8 +208,30 @@ func (o *OrderHandler) TheMostPopularItem(w http.ResponseWriter, r *http.Request
 	popularItem, err := o.service.MostPopularItem()
 	if err != nil {
 		slog.Warn(err.Error())
-		JsonWriter(w, 500, "", err)
+		JsonError(w, err)
+		return
+	}
+	TotalSalesAndPopularItemResponse(w, 200, nil, popularItem)
+}
+
+func (o *OrderHandler) TransitionOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	slog.Info("Request TransitionOrder")
+	id := r.PathValue("id")
+
+	var request TransitionRequest
+	if err := decodeJSON(r, &request); err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
+		return
+	}
+
+	order, err := o.service.Transition(id, request.Status)
+	if err != nil {
+		slog.Warn(err.Error())
+		JsonError(w, err)
 		return
 	}
-	TotalSalesAndPopularItemResponse(w, 200, 0, popularItem)
+	w.Header().Set("ETag", order.ETag())
+	JsonWriterItemForInventory(w, 200, nil, nil, &order, nil)
 }
@@ -0,0 +1,167 @@
+// Package patch накладывает JSON Merge Patch (RFC 7396) и JSON Patch
+// (RFC 6902) на JSON-документ.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"hot-coffee/internal/errorHandle"
+)
+
+// Типы содержимого запроса PATCH.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Merge накладывает merge patch: null удаляет поле, объекты сливаются
+// рекурсивно, остальные значения, включая массивы, заменяются целиком.
+func Merge(doc, patch []byte) ([]byte, error) {
+	target, err := parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parse(patch)
+	if err != nil {
+		return nil, errorHandle.ErrorFormatJson
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	result, ok := target.(map[string]any)
+	if !ok {
+		result = map[string]any{}
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = merge(result[key], value)
+	}
+	return result
+}
+
+// Operation — одна операция JSON Patch. Value без поля value остаётся nil,
+// а value: null сохраняется как "null": RFC 6902 разрешает null значением.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply выполняет операции JSON Patch по порядку. Если какая-то операция не
+// выполнилась, документ не меняется.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := parse(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ops); err != nil {
+		return nil, errorHandle.ErrorFormatJson
+	}
+
+	for _, op := range ops {
+		if target, err = apply(target, op); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(target)
+}
+
+func apply(doc any, op Operation) (any, error) {
+	if op.Path == nil {
+		return nil, invalid("", "path is required")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, invalid(*op.Path, "value is required")
+		}
+		value, err := parse(op.Value)
+		if err != nil {
+			return nil, invalid(*op.Path, "value is not valid JSON")
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if _, err := get(doc, path); err != nil {
+				return nil, err
+			}
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, errorHandle.PatchTestFailed.WithDetails(errorHandle.Detail{Field: *op.Path})
+		}
+		return doc, nil
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, invalid(*op.Path, "from is required")
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return add(doc, path, clone(value))
+		}
+		if from.contains(path) {
+			return nil, invalid(*op.Path, "can't move a value into itself")
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	}
+	return nil, invalid(*op.Path, "unknown operation "+op.Op)
+}
+
+func invalid(path, message string) error {
+	return errorHandle.InvalidPatch.WithDetails(errorHandle.Detail{Field: path, Message: message})
+}
+
+// parse разбирает JSON, сохраняя числа как json.Number, чтобы не терять точность.
+func parse(data []byte) (any, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errorHandle.ErrorFormatJson
+	}
+	return value, nil
+}
@@ -0,0 +1,221 @@
+package patch
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// pointer — разобранный JSON Pointer (RFC 6901); пустой указывает на весь документ.
+type pointer []string
+
+func parsePointer(path string) (pointer, error) {
+	if path == "" {
+		return pointer{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, invalid(path, "path must start with '/'")
+	}
+	tokens := strings.Split(path[1:], "/")
+	for n, token := range tokens {
+		for i := 0; i < len(token); i++ {
+			if token[i] == '~' && (i+1 == len(token) || (token[i+1] != '0' && token[i+1] != '1')) {
+				return nil, invalid(path, "'~' must be followed by 0 or 1")
+			}
+		}
+		tokens[n] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func (p pointer) String() string {
+	if len(p) == 0 {
+		return ""
+	}
+	escaped := make([]string, len(p))
+	for n, token := range p {
+		escaped[n] = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+// contains сообщает, что q лежит внутри значения по p.
+func (p pointer) contains(q pointer) bool {
+	if len(q) <= len(p) {
+		return false
+	}
+	for n := range p {
+		if p[n] != q[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(doc any, path pointer) (any, error) {
+	node := doc
+	for n := range path {
+		child, err := childOf(node, path[:n+1])
+		if err != nil {
+			return nil, err
+		}
+		node = child
+	}
+	return node, nil
+}
+
+func childOf(node any, path pointer) (any, error) {
+	key := path[len(path)-1]
+	switch container := node.(type) {
+	case map[string]any:
+		if value, ok := container[key]; ok {
+			return value, nil
+		}
+	case []any:
+		if i, ok := index(key, len(container)-1); ok {
+			return container[i], nil
+		}
+	}
+	return nil, invalid(path.String(), "path does not exist")
+}
+
+// index разбирает номер элемента массива не больше max. Ведущие нули
+// и знаки RFC 6901 не допускает.
+func index(token string, max int) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, false
+	}
+	return i, true
+}
+
+// update проходит до родителя последнего элемента path и заменяет его
+// результатом last; массивы при вставке и удалении пересоздаются, поэтому
+// новый родитель записывается обратно на каждом уровне.
+func update(node any, path, full pointer, last func(parent any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return last(node, path[0])
+	}
+	parentPath := full[:len(full)-len(path)+1]
+	child, err := childOf(node, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, path[1:], full, last)
+	if err != nil {
+		return nil, err
+	}
+	switch container := node.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		i, _ := index(path[0], len(container)-1)
+		container[i] = child
+	}
+	return node, nil
+}
+
+func add(doc any, path pointer, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, path, func(parent any, key string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			container[key] = value
+			return container, nil
+		case []any:
+			i, ok := len(container), key == "-"
+			if !ok {
+				i, ok = index(key, len(container))
+			}
+			if !ok {
+				return nil, invalid(path.String(), "array index is out of range")
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		}
+		return nil, invalid(path.String(), "parent is not an object or array")
+	})
+}
+
+func remove(doc any, path pointer) (any, error) {
+	if len(path) == 0 {
+		return nil, invalid("", "can't remove the whole document")
+	}
+	return update(doc, path, path, func(parent any, key string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			if _, ok := container[key]; ok {
+				delete(container, key)
+				return container, nil
+			}
+		case []any:
+			if i, ok := index(key, len(container)-1); ok {
+				return append(container[:i], container[i+1:]...), nil
+			}
+		}
+		return nil, invalid(path.String(), "path does not exist")
+	})
+}
+
+// equal сравнивает значения как JSON: числа — по величине, объекты — без учёта порядка ключей.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for n := range a {
+			if !equal(a[n], b[n]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	}
+	return a == b
+}
+
+func clone(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for key, v := range value {
+			copied[key] = clone(v)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for n, v := range value {
+			copied[n] = clone(v)
+		}
+		return copied
+	}
+	return value
+}
@@ -1,47 +1,94 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"hot-coffee/internal/dal"
 	"hot-coffee/internal/errorHandle"
+	"hot-coffee/internal/validate"
 	"hot-coffee/models"
+	"strings"
+	"time"
 )
 
 type InventoryService interface {
 	Create(item models.InventoryItem) error
-	GetAll() ([]models.InventoryItem, error)
+	GetAll(filter InventoryFilter) (List[models.InventoryItem], error)
 	GetItem(id string) (models.InventoryItem, error)
-	Update(item models.InventoryItem, id string) error
-	Delete(id string) error
+	Update(item models.InventoryItem, id, ifMatch string) error
+	Delete(id string, force bool, ifMatch string) error
+	Restore(id string) error
+	GetMovements(id, from, to string) ([]models.StockMovement, error)
+	Adjust(id string, adjustment models.StockAdjustment) (models.InventoryItem, error)
+	Restock(restock models.Restock) ([]models.InventoryItem, error)
+	LowStock() ([]models.LowStockItem, error)
+	Produce(id string, production models.Production) (models.InventoryItem, error)
 }
 
+// InventoryFilter отбирает ингредиенты склада; пустые поля не ограничивают выборку.
+type InventoryFilter struct {
+	Name            string
+	IncludeArchived bool
+	ListQuery
+}
+
+// inventorySort — поля сортировки склада.
+var inventorySort = map[string]compareFunc[models.InventoryItem]{
+	"ingredient_id": by(func(item models.InventoryItem) string { return item.IngredientID }),
+	"name":          by(func(item models.InventoryItem) string { return item.Name }),
+	"quantity":      by(func(item models.InventoryItem) float64 { return item.Quantity }),
+}
+
+// timeLayout совпадает с форматом дат в хранилище.
+const timeLayout = "2006-01-02 15:04:05"
+
 type inventoryService struct {
 	inventoryRepo dal.InventoryRepository
+	menuRepo      dal.MenuRepository
 }
 
-func NewInventoryService(inventoryRepo dal.InventoryRepository) InventoryService {
+func NewInventoryService(inventoryRepo dal.InventoryRepository, menuRepo dal.MenuRepository) InventoryService {
 	return &inventoryService{
 		inventoryRepo: inventoryRepo,
+		menuRepo:      menuRepo,
 	}
 }
 
 func (i *inventoryService) Create(item models.InventoryItem) error {
-	if item.IngredientID == "" || item.Name == "" || item.Unit == "" {
-		return errorHandle.ErrorFormatJson
+	if err := validate.InventoryItem(item); err != nil {
+		return err
 	}
-	if item.Quantity <= 0 {
-		return errorHandle.QuantityLessZero
+	if err := i.checkPrepared(item); err != nil {
+		return err
 	}
 
 	err := i.inventoryRepo.Create(item)
 	return err
 }
 
-func (i *inventoryService) GetAll() ([]models.InventoryItem, error) {
+func (i *inventoryService) GetAll(filter InventoryFilter) (List[models.InventoryItem], error) {
 	items, err := i.inventoryRepo.GetAll()
-	if err != nil {
-		return nil, err
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileInventory) {
+		return List[models.InventoryItem]{}, err
+	}
+
+	var result []models.InventoryItem
+	for _, item := range items {
+		if item.Archived() && !filter.IncludeArchived {
+			continue
+		}
+		if filter.Name != "" && !containsFold(item.Name, filter.Name) {
+			continue
+		}
+		result = append(result, item)
+	}
+
+	var v validate.Errors
+	sortList(result, filter.Sort, inventorySort, &v)
+	if err := v.Err(); err != nil {
+		return List[models.InventoryItem]{}, err
 	}
-	return items, nil
+	return page(result, filter.ListQuery), nil
 }
 
 func (i *inventoryService) GetItem(id string) (models.InventoryItem, error) {
@@ -52,20 +99,365 @@ func (i *inventoryService) GetItem(id string) (models.InventoryItem, error) {
 	return item, nil
 }
 
-func (i *inventoryService) Update(item models.InventoryItem, id string) error {
+// Update сохраняет ингредиент, если его версия подходит под ifMatch (If-Match);
+// пустой ifMatch ничего не требует.
+func (i *inventoryService) Update(item models.InventoryItem, id, ifMatch string) error {
 	if id != item.IngredientID {
 		return errorHandle.ChangeID
 	}
+	if err := validate.InventoryItem(item); err != nil {
+		return err
+	}
+	if err := i.checkPrepared(item); err != nil {
+		return err
+	}
+	if err := i.checkUnit(item); err != nil {
+		return err
+	}
+
+	return i.inventoryRepo.Update(item, id, ifMatch)
+}
+
+// Delete архивирует ингредиент: блюда с ним становятся недоступны, но история
+// движений и рецепты сохраняются. Ингредиент, который входит в блюда меню,
+// архивируется только с force, иначе возвращается DependencyError.
+func (i *inventoryService) Delete(id string, force bool, ifMatch string) error {
+	item, err := i.inventoryRepo.GetItem(id)
+	if err != nil {
+		return err
+	}
+	if item.Archived() {
+		return errorHandle.NotFoundID
+	}
 
-	if item.Quantity <= 0 {
-		return errorHandle.QuantityLessZero
+	dependents, err := i.dependents(id)
+	if err != nil {
+		return err
 	}
+	if len(dependents) > 0 && !force {
+		return errorHandle.HasDependents.WithDetails(dependents...)
+	}
+	return i.inventoryRepo.Archive(id, time.Now().Format(timeLayout), ifMatch)
+}
 
-	err := i.inventoryRepo.Update(item, id)
-	return err
+func (i *inventoryService) Restore(id string) error {
+	item, err := i.inventoryRepo.GetItem(id)
+	if err != nil {
+		return err
+	}
+	if !item.Archived() {
+		return errorHandle.NotArchived
+	}
+	return i.inventoryRepo.Archive(id, "", "")
 }
 
-func (i *inventoryService) Delete(id string) error {
-	err := i.inventoryRepo.Delete(id)
-	return err
+// dependents перечисляет блюда меню и заготовки (кроме архивных), которые используют ингредиент.
+func (i *inventoryService) dependents(id string) ([]errorHandle.Detail, error) {
+	items, err := i.menuRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFile) {
+		return nil, err
+	}
+
+	var dependents []errorHandle.Detail
+	for _, item := range items {
+		if !item.Archived() && item.Uses(id) {
+			dependents = append(dependents, errorHandle.Detail{Type: "menu_item", ID: item.ID})
+		}
+	}
+
+	stocked, err := i.inventoryRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileInventory) {
+		return nil, err
+	}
+	for _, item := range stocked {
+		if !item.Archived() && item.Uses(id) {
+			dependents = append(dependents, errorHandle.Detail{Type: "inventory_item", ID: item.IngredientID})
+		}
+	}
+	return dependents, nil
+}
+
+// checkUnit не даёт сменить единицу склада, если рецепты с этим ингредиентом
+// (блюда меню, в том числе архивные, добавки и замены модификаторов,
+// заготовки) перестанут сходиться: строку без единицы прочитали бы в новой
+// единице, а строку с единицей другой размерности — не перевели бы.
+func (i *inventoryService) checkUnit(item models.InventoryItem) error {
+	old, err := i.inventoryRepo.GetItem(item.IngredientID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(old.Unit, item.Unit) {
+		return nil
+	}
+
+	id, unit := item.IngredientID, item.Unit
+	var details []errorHandle.Detail
+	check := func(kind, owner, field string, line models.MenuItemIngredient) {
+		if line.IngredientID != id {
+			return
+		}
+		if message := unitConflict(line, unit); message != "" {
+			details = append(details, errorHandle.Detail{Type: kind, ID: owner, Field: field, Message: message})
+		}
+	}
+
+	menu, err := i.menuRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFile) {
+		return err
+	}
+	for _, menuItem := range menu {
+		for n, line := range menuItem.Ingredients {
+			check("menu_item", menuItem.ID, fmt.Sprintf("ingredients[%d].unit", n), line)
+		}
+		for n, modifier := range menuItem.Modifiers {
+			for k, line := range modifier.Add {
+				check("menu_item", menuItem.ID, fmt.Sprintf("modifiers[%d].add[%d].unit", n, k), line)
+			}
+			for k, substitution := range modifier.Replace {
+				if substitution.To != id {
+					continue
+				}
+				// Замена отмеряется строкой заменяемого ингредиента; без единицы
+				// это единицы его склада, и они должны совпадать с новой.
+				line, ok := findIngredient(menuItem.Ingredients, substitution.From)
+				if !ok {
+					continue
+				}
+				field := fmt.Sprintf("modifiers[%d].replace[%d].to", n, k)
+				if line.Unit != "" {
+					line.IngredientID = id
+					check("menu_item", menuItem.ID, field, line)
+					continue
+				}
+				from, err := i.inventoryRepo.GetItem(substitution.From)
+				if err != nil {
+					return err
+				}
+				if !strings.EqualFold(from.Unit, unit) {
+					message := fmt.Sprintf("quantity of %s is measured in %s and would be read in %s", substitution.From, from.Unit, unit)
+					details = append(details, errorHandle.Detail{Type: "menu_item", ID: menuItem.ID, Field: field, Message: message})
+				}
+			}
+		}
+	}
+
+	stocked, err := i.inventoryRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileInventory) {
+		return err
+	}
+	for _, prepared := range stocked {
+		if !prepared.Prepared() {
+			continue
+		}
+		for n, line := range prepared.Recipe.Ingredients {
+			check("inventory_item", prepared.IngredientID, fmt.Sprintf("recipe.ingredients[%d].unit", n), line)
+		}
+	}
+
+	if len(details) > 0 {
+		return errorHandle.UnitMismatch.WithDetails(details...)
+	}
+	return nil
+}
+
+// unitConflict объясняет, почему строка рецепта не сойдётся с новой единицей
+// склада unit; пустая строка — сойдётся.
+func unitConflict(line models.MenuItemIngredient, unit string) string {
+	if line.Unit == "" {
+		return "quantity has no unit and would be read in " + unit
+	}
+	if _, err := models.ConvertQuantity(line.Quantity, line.Unit, unit); err != nil {
+		return fmt.Sprintf("%s can't be converted to %s", line.Unit, unit)
+	}
+	return ""
+}
+
+// checkPrepared проверяет рецепт заготовки (поля уже проверены): ингредиенты
+// есть на складе, единицы переводятся, а рецепт не ссылается сам на себя.
+func (i *inventoryService) checkPrepared(item models.InventoryItem) error {
+	if !item.Prepared() {
+		return nil
+	}
+
+	stock, err := stockIndex(i.inventoryRepo)
+	if err != nil {
+		return err
+	}
+	stock[item.IngredientID] = item
+
+	for _, line := range item.Recipe.Ingredients {
+		if line.IngredientID == item.IngredientID {
+			return errorHandle.RecipeCycle
+		}
+		input, ok := stock[line.IngredientID]
+		if !ok {
+			return errorHandle.UnknownIngredient
+		}
+		if _, err := models.ConvertQuantity(line.Quantity, line.Unit, input.Unit); err != nil {
+			return err
+		}
+	}
+	return findCycle(item.IngredientID, stock)
+}
+
+// Produce готовит заготовку: списывает ингредиенты по рецепту и добавляет
+// готовое количество одним изменением склада.
+func (i *inventoryService) Produce(id string, production models.Production) (models.InventoryItem, error) {
+	if err := validate.Production(production); err != nil {
+		return models.InventoryItem{}, err
+	}
+
+	stock, err := stockIndex(i.inventoryRepo)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	item, ok := stock[id]
+	if !ok {
+		return models.InventoryItem{}, errorHandle.NotFoundID
+	}
+	if !item.Prepared() {
+		return models.InventoryItem{}, errorHandle.NotPrepared
+	}
+
+	quantity := production.Quantity
+	if quantity == 0 {
+		quantity = item.Recipe.Yield
+	}
+	inputs, err := inputsOf(item, quantity, stock)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+
+	adjustments := make([]models.StockAdjustment, 0, len(inputs)+1)
+	for _, input := range inputs {
+		adjustments = append(adjustments, models.StockAdjustment{
+			IngredientID: input.id,
+			Delta:        -input.quantity,
+			Reason:       models.ReasonProductionInput,
+			ReferenceID:  production.ReferenceID,
+		})
+	}
+	adjustments = append(adjustments, models.StockAdjustment{
+		IngredientID: id,
+		Delta:        quantity,
+		Reason:       models.ReasonProduction,
+		ReferenceID:  production.ReferenceID,
+	})
+
+	items, err := i.inventoryRepo.Adjust(adjustments)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	for _, produced := range items {
+		if produced.IngredientID == id {
+			return produced, nil
+		}
+	}
+	return models.InventoryItem{}, errorHandle.ServerError
+}
+
+func (i *inventoryService) GetMovements(id, from, to string) ([]models.StockMovement, error) {
+	if _, err := i.inventoryRepo.GetItem(id); err != nil {
+		return nil, err
+	}
+
+	fromTime, err := parseDate(from, false)
+	if err != nil {
+		return nil, err
+	}
+	toTime, err := parseDate(to, true)
+	if err != nil {
+		return nil, err
+	}
+	if !fromTime.IsZero() && !toTime.IsZero() && fromTime.After(toTime) {
+		return nil, errorHandle.InvalidDateRange
+	}
+
+	return i.inventoryRepo.GetMovements(id, fromTime, toTime)
+}
+
+// parseDate принимает дату (2006-01-02), дату со временем или RFC3339.
+// Для конца периода дата без времени означает конец дня.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(timeLayout, value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Local(), nil
+	}
+	return time.Time{}, errorHandle.InvalidDateRange
+}
+
+func (i *inventoryService) Adjust(id string, adjustment models.StockAdjustment) (models.InventoryItem, error) {
+	if adjustment.IngredientID != "" && adjustment.IngredientID != id {
+		return models.InventoryItem{}, errorHandle.ChangeID
+	}
+	if err := validate.StockAdjustment(adjustment); err != nil {
+		return models.InventoryItem{}, err
+	}
+
+	switch adjustment.Reason {
+	case "":
+		adjustment.Reason = models.ReasonManualAdjustment
+	case models.ReasonManualAdjustment, models.ReasonDelivery, models.ReasonWaste, models.ReasonStockCount:
+	default:
+		// Движения по заказам пишет только сервис заказов.
+		return models.InventoryItem{}, errorHandle.InvalidReason
+	}
+	adjustment.IngredientID = id
+
+	items, err := i.inventoryRepo.Adjust([]models.StockAdjustment{adjustment})
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	return items[0], nil
+}
+
+func (i *inventoryService) Restock(restock models.Restock) ([]models.InventoryItem, error) {
+	if err := validate.Restock(restock); err != nil {
+		return nil, err
+	}
+
+	adjustments := make([]models.StockAdjustment, 0, len(restock.Items))
+	for _, delivery := range restock.Items {
+		adjustments = append(adjustments, models.StockAdjustment{
+			IngredientID: delivery.IngredientID,
+			Delta:        delivery.Quantity,
+			Reason:       models.ReasonDelivery,
+			ReferenceID:  restock.ReferenceID,
+		})
+	}
+
+	return i.inventoryRepo.Adjust(adjustments)
+}
+
+// LowStock возвращает ингредиенты, остаток которых дошёл до точки заказа,
+// и сколько нужно дозаказать до нормы.
+func (i *inventoryService) LowStock() ([]models.LowStockItem, error) {
+	items, err := i.inventoryRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileInventory) {
+		return nil, err
+	}
+
+	result := []models.LowStockItem{}
+	for _, item := range items {
+		if item.Archived() || item.ReorderPoint <= 0 || item.Quantity > item.ReorderPoint {
+			continue
+		}
+		lowStock := models.LowStockItem{InventoryItem: item}
+		if item.ParLevel > item.Quantity {
+			lowStock.ReorderQuantity = item.ParLevel - item.Quantity
+		}
+		result = append(result, lowStock)
+	}
+	return result, nil
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"cmp"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/validate"
+	"slices"
+	"strings"
+)
+
+// ListQuery — общие параметры списков: сортировка и страница. Фильтры у
+// каждого списка свои.
+type ListQuery struct {
+	Sort   string // поля через запятую, "-" перед полем — по убыванию
+	Limit  int
+	Offset int
+}
+
+// List — страница списка и число всех записей, подходящих под фильтры.
+type List[T any] struct {
+	Items []T
+	Total int
+}
+
+// compareFunc сравнивает две записи по одному полю сортировки.
+type compareFunc[T any] func(a, b T) int
+
+// parseSort разбирает параметр sort; поля, для которых known возвращает
+// false, попадают в v.
+func parseSort(query string, known func(name string) bool, v *validate.Errors) []dal.SortField {
+	if query == "" {
+		return nil
+	}
+	var fields []dal.SortField
+	for _, field := range strings.Split(query, ",") {
+		field = strings.TrimSpace(field)
+		name, desc := strings.CutPrefix(field, "-")
+		if !known(name) {
+			v.Add("sort", validate.CodeInvalid, "can't sort by "+field)
+			continue
+		}
+		fields = append(fields, dal.SortField{Name: name, Desc: desc})
+	}
+	return fields
+}
+
+// sortList сортирует записи по query.Sort. Неизвестные поля попадают в v;
+// при равенстве по всем полям сохраняется исходный порядок.
+func sortList[T any](items []T, query string, fields map[string]compareFunc[T], v *validate.Errors) {
+	var order []compareFunc[T]
+	for _, field := range parseSort(query, func(name string) bool { _, ok := fields[name]; return ok }, v) {
+		compare := fields[field.Name]
+		if field.Desc {
+			compare = func(a, b T) int { return fields[field.Name](b, a) }
+		}
+		order = append(order, compare)
+	}
+	if len(order) == 0 {
+		return
+	}
+
+	slices.SortStableFunc(items, func(a, b T) int {
+		for _, compare := range order {
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+// page вырезает страницу; нулевой Limit означает все записи после Offset.
+func page[T any](items []T, query ListQuery) List[T] {
+	list := List[T]{Items: []T{}, Total: len(items)}
+	if query.Offset >= len(items) {
+		return list
+	}
+	items = items[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(items) {
+		items = items[:query.Limit]
+	}
+	list.Items = items
+	return list
+}
+
+// by сравнивает записи по значению поля.
+func by[T any, K cmp.Ordered](field func(T) K) compareFunc[T] {
+	return func(a, b T) int { return cmp.Compare(field(a), field(b)) }
+}
+
+// containsFold ищет подстроку без учёта регистра.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -1,48 +1,125 @@
 package service
 
 import (
+	"errors"
 	"hot-coffee/internal/dal"
 	"hot-coffee/internal/errorHandle"
+	"hot-coffee/internal/validate"
 	"hot-coffee/models"
+	"sort"
+	"strings"
+	"time"
 )
 
 type MenuService interface {
 	Create(item models.MenuItem) error
-	GetAll() ([]models.MenuItem, error)
+	GetAll(filter MenuFilter) (List[models.MenuItem], error)
 	GetItem(id string) (models.MenuItem, error)
-	Update(item models.MenuItem, id string) error
-	Delete(id string) error
+	Update(item models.MenuItem, id, ifMatch string) error
+	Delete(id string, force bool, ifMatch string) error
+	Restore(id string) error
+	Availability() ([]models.MenuStock, error)
+}
+
+// MenuFilter отбирает блюда меню; пустые поля не ограничивают выборку.
+type MenuFilter struct {
+	Category        models.Category
+	Tag             string
+	Name            string
+	AvailableNow    bool
+	IncludeArchived bool
+	ListQuery
+}
+
+// menuSort — поля сортировки меню.
+var menuSort = map[string]compareFunc[models.MenuItem]{
+	"product_id": by(func(item models.MenuItem) string { return item.ID }),
+	"name":       by(func(item models.MenuItem) string { return item.Name }),
+	"category":   by(func(item models.MenuItem) models.Category { return item.Category }),
+	"price":      by(func(item models.MenuItem) int64 { return item.Price.Amount }),
+	"sort_order": by(func(item models.MenuItem) int { return item.SortOrder }),
 }
 
 type menuService struct {
-	menuRepo dal.MenuRepository
+	menuRepo      dal.MenuRepository
+	inventoryRepo dal.InventoryRepository
+	orderRepo     dal.OrderRepository
 }
 
-func NewMenuService(menuRepo dal.MenuRepository) MenuService {
+func NewMenuService(menuRepo dal.MenuRepository, inventoryRepo dal.InventoryRepository, orderRepo dal.OrderRepository) MenuService {
 	return &menuService{
-		menuRepo: menuRepo,
+		menuRepo:      menuRepo,
+		inventoryRepo: inventoryRepo,
+		orderRepo:     orderRepo,
 	}
 }
 
 func (m *menuService) Create(item models.MenuItem) error {
-	if item.ID == "" || item.Name == "" || len(item.Ingredients) == 0 || item.Description == "" {
-		return errorHandle.ErrorFormatJson
+	if err := validate.MenuItem(item); err != nil {
+		return err
 	}
-
-	if item.Price <= 0 {
-		return errorHandle.PriceLessZero
+	if err := m.checkRecipe(item.Ingredients); err != nil {
+		return err
+	}
+	if err := m.checkModifiers(item); err != nil {
+		return err
 	}
 
+	item.Stock = nil
 	err := m.menuRepo.Create(item)
 	return err
 }
 
-func (m *menuService) GetAll() ([]models.MenuItem, error) {
-	result, err := m.menuRepo.GetAll()
+// GetAll возвращает страницу меню. Без sort блюда идут по sort_order, а
+// блюда без него — в порядке добавления.
+func (m *menuService) GetAll(filter MenuFilter) (List[models.MenuItem], error) {
+	if !filter.Category.Valid() {
+		return List[models.MenuItem]{}, errorHandle.InvalidCategory
+	}
+	items, err := m.menuRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFile) {
+		return List[models.MenuItem]{}, err
+	}
+
+	now := time.Now()
+	var result []models.MenuItem
+	for _, item := range items {
+		if item.Archived() && !filter.IncludeArchived {
+			continue
+		}
+		if filter.Category != "" && item.Category != filter.Category {
+			continue
+		}
+		if filter.Tag != "" && !item.HasTag(filter.Tag) {
+			continue
+		}
+		if filter.Name != "" && !containsFold(item.Name, filter.Name) {
+			continue
+		}
+		if filter.AvailableNow && !item.Available.AvailableAt(now) {
+			continue
+		}
+		result = append(result, item)
+	}
+
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].SortOrder < result[b].SortOrder
+	})
+	var v validate.Errors
+	sortList(result, filter.Sort, menuSort, &v)
+	if err := v.Err(); err != nil {
+		return List[models.MenuItem]{}, err
+	}
+
+	list := page(result, filter.ListQuery)
+	stock, err := stockIndex(m.inventoryRepo)
 	if err != nil {
-		return nil, err
+		return List[models.MenuItem]{}, err
+	}
+	for n := range list.Items {
+		list.Items[n].Stock = stockStatus(list.Items[n], stock)
 	}
-	return result, err
+	return list, nil
 }
 
 func (m *menuService) GetItem(id string) (models.MenuItem, error) {
@@ -50,24 +127,220 @@ func (m *menuService) GetItem(id string) (models.MenuItem, error) {
 	if err != nil {
 		return models.MenuItem{}, err
 	}
-	return item, err
+	stock, err := stockIndex(m.inventoryRepo)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	item.Stock = stockStatus(item, stock)
+	return item, nil
 }
 
-func (m *menuService) Update(item models.MenuItem, id string) error {
-	if item.ID == "" || item.Name == "" || len(item.Ingredients) == 0 || item.Description == "" {
-		return errorHandle.ErrorFormatJson
+// Availability возвращает для каждого блюда число порций из текущих остатков.
+func (m *menuService) Availability() ([]models.MenuStock, error) {
+	items, err := m.menuRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFile) {
+		return nil, err
 	}
-	if item.Price <= 0 {
-		return errorHandle.PriceLessZero
+	stock, err := stockIndex(m.inventoryRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.MenuStock, 0, len(items))
+	for _, item := range items {
+		if item.Archived() {
+			continue
+		}
+		result = append(result, models.MenuStock{
+			ProductID:   item.ID,
+			Name:        item.Name,
+			StockStatus: *stockStatus(item, stock),
+		})
+	}
+	return result, nil
+}
+
+// stockStatus считает порции базового рецепта (варианты по умолчанию, без
+// модификаторов) из остатков и, если в рецепте есть заготовки, — сколько
+// порций выйдет, если приготовить недостающие заготовки. Ингредиент, которого
+// нет на складе или который нельзя перевести в единицы склада, сразу делает
+// блюдо недоступным.
+func stockStatus(item models.MenuItem, stock map[string]models.InventoryItem) *models.StockStatus {
+	recipe, _, err := item.Recipe(nil, nil)
+	if err != nil {
+		return &models.StockStatus{}
+	}
+
+	need := make([]requirement, 0, len(recipe))
+	prepared := false
+	for _, line := range recipe {
+		stocked, ok := stock[line.IngredientID]
+		if !ok {
+			return &models.StockStatus{LimitingIngredient: line.IngredientID}
+		}
+		quantity, err := models.ConvertQuantity(line.Quantity, line.Unit, stocked.Unit)
+		if err != nil {
+			return &models.StockStatus{LimitingIngredient: line.IngredientID}
+		}
+		need = append(need, requirement{id: line.IngredientID, quantity: quantity})
+		prepared = prepared || stocked.Prepared()
 	}
+
+	status := &models.StockStatus{}
+	status.MaxPortions, status.LimitingIngredient = portions(need, stock, false)
+	status.Available = status.MaxPortions > 0
+	if prepared {
+		status.ProduciblePortions, _ = portions(need, stock, true)
+	}
+	return status
+}
+
+// Update сохраняет блюдо, если его версия подходит под ifMatch (If-Match);
+// пустой ifMatch ничего не требует.
+func (m *menuService) Update(item models.MenuItem, id, ifMatch string) error {
 	if item.ID != id {
 		return errorHandle.ChangeID
 	}
-	err := m.menuRepo.Update(item, id)
-	return err
+	if err := validate.MenuItem(item); err != nil {
+		return err
+	}
+	if err := m.checkRecipe(item.Ingredients); err != nil {
+		return err
+	}
+	if err := m.checkModifiers(item); err != nil {
+		return err
+	}
+	item.Stock = nil
+	return m.menuRepo.Update(item, id, ifMatch)
+}
+
+// Delete архивирует блюдо: заказать его больше нельзя, но старые заказы
+// по-прежнему находят рецепт и цену. Блюдо, которое есть в заказах,
+// архивируется только с force, иначе возвращается DependencyError.
+func (m *menuService) Delete(id string, force bool, ifMatch string) error {
+	item, err := m.menuRepo.GetItem(id)
+	if err != nil {
+		return err
+	}
+	if item.Archived() {
+		return errorHandle.NotFoundID
+	}
+
+	dependents, err := m.dependents(id)
+	if err != nil {
+		return err
+	}
+	if len(dependents) > 0 && !force {
+		return errorHandle.HasDependents.WithDetails(dependents...)
+	}
+	return m.menuRepo.Archive(id, time.Now().Format(timeLayout), ifMatch)
+}
+
+func (m *menuService) Restore(id string) error {
+	item, err := m.menuRepo.GetItem(id)
+	if err != nil {
+		return err
+	}
+	if !item.Archived() {
+		return errorHandle.NotArchived
+	}
+	return m.menuRepo.Archive(id, "", "")
 }
 
-func (m *menuService) Delete(id string) error {
-	err := m.menuRepo.Delete(id)
+// dependents перечисляет заказы с этим блюдом.
+func (m *menuService) dependents(id string) ([]errorHandle.Detail, error) {
+	orders, err := m.orderRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileOrders) {
+		return nil, err
+	}
+
+	var dependents []errorHandle.Detail
+	for _, order := range orders {
+		for _, item := range order.Items {
+			if item.ProductID == id {
+				dependents = append(dependents, errorHandle.Detail{Type: "order", ID: order.ID})
+				break
+			}
+		}
+	}
+	return dependents, nil
+}
+
+// checkRecipe проверяет, что ингредиенты есть на складе, а единицы рецепта
+// переводятся в единицы склада.
+func (m *menuService) checkRecipe(ingredients []models.MenuItemIngredient) error {
+	for _, ingredient := range ingredients {
+		stock, err := m.ingredient(ingredient.IngredientID)
+		if err != nil {
+			return err
+		}
+		if _, err := models.ConvertQuantity(ingredient.Quantity, ingredient.Unit, stock.Unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkModifiers проверяет ингредиенты модификаторов по складу: добавки
+// должны быть на складе, а замены — отмеряться в том же количестве. Поля
+// вариантов и модификаторов уже проверены в validate.MenuItem.
+func (m *menuService) checkModifiers(item models.MenuItem) error {
+	for _, modifier := range item.Modifiers {
+		for _, substitution := range modifier.Replace {
+			if err := m.checkSubstitution(item.Ingredients, substitution); err != nil {
+				return err
+			}
+		}
+		if err := m.checkRecipe(modifier.Add); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSubstitution проверяет, что заменяемый ингредиент есть в рецепте,
+// а замену можно отмерить в том же количестве.
+func (m *menuService) checkSubstitution(ingredients []models.MenuItemIngredient, substitution models.Substitution) error {
+	line, ok := findIngredient(ingredients, substitution.From)
+	if !ok {
+		return errorHandle.InvalidOption
+	}
+	to, err := m.ingredient(substitution.To)
+	if err != nil {
+		return err
+	}
+
+	unit := line.Unit
+	if unit == "" {
+		// Количество без единицы задано в единицах склада исходного ингредиента,
+		// и замена прочитает его в своих: единицы должны совпадать.
+		from, err := m.inventoryRepo.GetItem(substitution.From)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(from.Unit, to.Unit) {
+			return errorHandle.UnitMismatch
+		}
+		return nil
+	}
+	_, err = models.ConvertQuantity(line.Quantity, unit, to.Unit)
 	return err
 }
+
+// ingredient возвращает ингредиент склада, на который может сослаться рецепт.
+func (m *menuService) ingredient(id string) (models.InventoryItem, error) {
+	item, err := m.inventoryRepo.GetItem(id)
+	if errors.Is(err, errorHandle.NotFoundID) || err == nil && item.Archived() {
+		return item, errorHandle.UnknownIngredient
+	}
+	return item, err
+}
+
+func findIngredient(ingredients []models.MenuItemIngredient, id string) (models.MenuItemIngredient, bool) {
+	for _, ingredient := range ingredients {
+		if ingredient.IngredientID == id {
+			return ingredient, true
+		}
+	}
+	return models.MenuItemIngredient{}, false
+}
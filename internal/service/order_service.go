@@ -1,26 +1,75 @@
 package service
 
 import (
+	"errors"
 	"hot-coffee/internal/dal"
 	"hot-coffee/internal/errorHandle"
+	"hot-coffee/internal/validate"
 	"hot-coffee/models"
+	"time"
 )
 
 type OrderService interface {
 	Create(order models.Order) error
-	GetAll() ([]models.Order, error)
+	GetAll(filter OrderFilter) (List[models.Order], error)
 	GetItem(id string) (models.Order, error)
-	Update(item models.Order, id string) error
-	Delete(id string) error
+	Update(item models.Order, id, ifMatch string) error
+	Patch(item models.Order, id, ifMatch string) error
+	Delete(id, ifMatch string) error
 	UpdateStatus(id string) error
-	TotalSum() (float64, error)
+	Transition(id string, status models.OrderStatus) (models.Order, error)
+	TotalSum() (models.Money, error)
 	MostPopularItem() (string, error)
 }
 
+// OrderFilter отбирает заказы; пустые поля не ограничивают выборку. Даты
+// принимаются в тех же форматах, что и в журнале движений склада.
+type OrderFilter struct {
+	Status       []models.OrderStatus
+	CustomerName string
+	ProductID    string
+	CreatedFrom  string
+	CreatedTo    string
+	ListQuery
+}
+
 type orderService struct {
 	orderRepo     dal.OrderRepository
 	menuRepo      dal.MenuRepository
 	inventoryRepo dal.InventoryRepository
+	unitOfWork    dal.UnitOfWork
+}
+
+// transitions — допустимые переходы статусов заказа. Первый переход в
+// списке — следующий шаг обычного пути от приёма до выдачи.
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.StatusReceived:      {models.StatusInPreparation, models.StatusCancelled},
+	models.StatusInPreparation: {models.StatusReady, models.StatusCancelled},
+	models.StatusReady:         {models.StatusPickedUp, models.StatusCancelled},
+	models.StatusPickedUp:      {models.StatusRefunded},
+}
+
+func canTransition(from, to models.OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func knownStatus(status models.OrderStatus) bool {
+	switch status {
+	case models.StatusReceived, models.StatusInPreparation, models.StatusReady,
+		models.StatusPickedUp, models.StatusCancelled, models.StatusRefunded:
+		return true
+	}
+	return false
+}
+
+// isSale — заказ учитывается в отчётах: отменённые и возвращённые не считаются.
+func isSale(order models.Order) bool {
+	return order.Status != models.StatusCancelled && order.Status != models.StatusRefunded
 }
 
 type GetPopularItem struct {
@@ -28,57 +77,70 @@ type GetPopularItem struct {
 	quantity int
 }
 
-func NewOrderService(orderRepo dal.OrderRepository, menuRepo dal.MenuRepository, inventoryRepo dal.InventoryRepository) OrderService {
+func NewOrderService(orderRepo dal.OrderRepository, menuRepo dal.MenuRepository, inventoryRepo dal.InventoryRepository, unitOfWork dal.UnitOfWork) OrderService {
 	return &orderService{
 		orderRepo:     orderRepo,
 		menuRepo:      menuRepo,
 		inventoryRepo: inventoryRepo,
+		unitOfWork:    unitOfWork,
 	}
 }
 
 func (o *orderService) Create(order models.Order) error {
-	if order.ID != "" || order.CustomerName == "" || len(order.Items) == 0 {
-		return errorHandle.ErrorFormatJson
-	}
-	for _, item := range order.Items {
-		if item.Quantity <= 0 {
-			return errorHandle.QuantityLessZero
-		}
-		if item.ProductID == "" {
-			return errorHandle.ErrorFormatJson
-		}
+	if err := validate.NewOrder(order); err != nil {
+		return err
 	}
 
-	for _, items := range order.Items {
-		if exists := o.menuRepo.ExistsByID(items.ProductID); !exists {
-			return errorHandle.NotFoundID
+	return o.unitOfWork.Do(func(tx dal.Tx) error {
+		if err := o.priceItems(tx, &order, nil); err != nil {
+			return err
 		}
-	}
-
-	for _, item := range order.Items {
-		err := o.menuRepo.MenuCalcuation(item.ProductID, float64(item.Quantity))
+		created, err := tx.Orders().Create(order)
 		if err != nil {
 			return err
 		}
-	}
+		return o.consume(tx, created.ID, created.Items)
+	})
+}
 
-	for _, item := range order.Items {
-		err := o.menuRepo.MenuConsumptionOfIngredients(item.ProductID, float64(item.Quantity), false)
-		if err != nil {
-			return err
+func (o *orderService) GetAll(filter OrderFilter) (List[models.Order], error) {
+	var v validate.Errors
+	for _, status := range filter.Status {
+		if !knownStatus(status) {
+			v.Add("status", validate.CodeInvalid, "unknown order status "+string(status))
 		}
 	}
+	from, err := parseDate(filter.CreatedFrom, false)
+	if err != nil {
+		v.Add("created_from", validate.CodeInvalid, "must be a date or date and time")
+	}
+	to, err := parseDate(filter.CreatedTo, true)
+	if err != nil {
+		v.Add("created_to", validate.CodeInvalid, "must be a date or date and time")
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		v.Add("created_to", validate.CodeOutOfRange, "must not be before created_from")
+	}
 
-	err := o.orderRepo.Create(order)
-	return err
-}
+	sort := parseSort(filter.Sort, dal.OrderSortable, &v)
+	if err := v.Err(); err != nil {
+		return List[models.Order]{}, err
+	}
 
-func (o *orderService) GetAll() ([]models.Order, error) {
-	result, err := o.orderRepo.GetAll()
+	orders, total, err := o.orderRepo.Query(dal.OrderQuery{
+		Status:       filter.Status,
+		CustomerName: filter.CustomerName,
+		ProductID:    filter.ProductID,
+		From:         from,
+		To:           to,
+		Sort:         sort,
+		Limit:        filter.Limit,
+		Offset:       filter.Offset,
+	})
 	if err != nil {
-		return nil, err
+		return List[models.Order]{}, err
 	}
-	return result, err
+	return List[models.Order]{Items: orders, Total: total}, nil
 }
 
 func (o *orderService) GetItem(id string) (models.Order, error) {
@@ -92,130 +154,282 @@ func (o *orderService) GetItem(id string) (models.Order, error) {
 	return result, err
 }
 
-func (o *orderService) Update(order models.Order, id string) error {
+// Update меняет заказ, если его версия подходит под ifMatch (If-Match);
+// версия сверяется внутри той же единицы работы, что и запись.
+func (o *orderService) Update(order models.Order, id, ifMatch string) error {
 	if id != order.ID {
 		return errorHandle.ChangeID
 	}
 
-	if order.Status != "" {
-		return errorHandle.ErrorFormatJson
+	if err := validate.Order(order); err != nil {
+		return err
 	}
 
-	if order.CreatedAt != "" {
-		return errorHandle.ErrorFormatJson
-	}
+	return o.unitOfWork.Do(func(tx dal.Tx) error {
+		oldOrder, err := tx.Orders().GetItem(id)
+		if err != nil {
+			return err
+		}
+		if !models.MatchETag(ifMatch, oldOrder.ETag()) {
+			return errorHandle.PreconditionFailed
+		}
+
+		// Заказ можно менять, пока его не начали готовить.
+		if oldOrder.Status != models.StatusReceived {
+			return errorHandle.OrderLocked
+		}
+
+		if oldOrder.CustomerName != order.CustomerName {
+			return errorHandle.ChangeName
+		}
+		order.Status, order.StatusHistory, order.CreatedAt = oldOrder.Status, oldOrder.StatusHistory, oldOrder.CreatedAt
+		if err := o.priceItems(tx, &order, oldOrder.Items); err != nil {
+			return err
+		}
+
+		if err := o.refund(tx, id, oldOrder.Items); err != nil {
+			return err
+		}
+		if err := o.consume(tx, id, order.Items); err != nil {
+			return err
+		}
+		return tx.Orders().Update(order, id)
+	})
+}
 
-	oldOrder, err := o.orderRepo.GetItem(id)
+// Patch сохраняет заказ, собранный патчем поверх сохранённого. Статус,
+// история и время создания должны прийти без изменений.
+func (o *orderService) Patch(order models.Order, id, ifMatch string) error {
+	old, err := o.orderRepo.GetItem(id)
 	if err != nil {
 		return err
 	}
-
-	if oldOrder.Status == "Close" {
-		return errorHandle.StatusExists
-	}
-
-	if oldOrder.CustomerName != order.CustomerName {
-		return errorHandle.ChangeName
+	if err := validate.OrderPatch(old, order); err != nil {
+		return err
 	}
+	order.Status, order.StatusHistory, order.CreatedAt = "", nil, ""
+	return o.Update(order, id, ifMatch)
+}
 
-	for _, items := range oldOrder.Items {
-		err := o.menuRepo.MenuConsumptionOfIngredients(items.ProductID, float64(items.Quantity), true)
+func (o *orderService) Delete(id, ifMatch string) error {
+	return o.unitOfWork.Do(func(tx dal.Tx) error {
+		order, err := tx.Orders().GetItem(id)
 		if err != nil {
 			return err
 		}
-	}
+		if !models.MatchETag(ifMatch, order.ETag()) {
+			return errorHandle.PreconditionFailed
+		}
 
-	if order.CustomerName == "" || len(order.Items) == 0 {
-		return errorHandle.ErrorFormatJson
-	}
-	for _, item := range order.Items {
-		if item.Quantity <= 0 {
-			return errorHandle.QuantityLessZero
+		if !order.Status.Active() {
+			return errorHandle.DeleteOrder
 		}
-		if item.ProductID == "" {
-			return errorHandle.ErrorFormatJson
+
+		if err := o.refund(tx, id, order.Items); err != nil {
+			return err
 		}
+		return tx.Orders().Delete(id)
+	})
+}
+
+// priceItems фиксирует в заказе названия, цены и рецепты блюд с учётом
+// вариантов и модификаторов; рецепт переводится в единицы склада. Позиции,
+// которые уже были в заказе previous, сохраняют прежние цену и рецепт и не
+// сверяются с меню: блюдо или его опции могли убрать после заказа. Новые
+// позиции можно добавить, только пока блюдо есть в меню и доступно. Рецепт
+// от клиента не берётся.
+func (o *orderService) priceItems(tx dal.Tx, order *models.Order, previous []models.OrderItem) error {
+	now := time.Now()
+	var subtotal models.Money
+	for n, item := range order.Items {
+		if snapshot, ok := findSnapshot(previous, item); ok {
+			item.Name, item.UnitPrice, item.Recipe = snapshot.Name, snapshot.UnitPrice, snapshot.Recipe
+		} else {
+			menuItem, err := o.menuRepo.GetItem(item.ProductID)
+			if err != nil {
+				return err
+			}
+			if menuItem.Archived() {
+				return errorHandle.NotFoundID
+			}
+			if !menuItem.Available.AvailableAt(now) {
+				return errorHandle.NotAvailable
+			}
+			recipe, price, err := menuItem.Recipe(item.Variants, item.Modifiers)
+			if err != nil {
+				return err
+			}
+			if recipe, err = dal.StockRecipe(tx.Inventory(), recipe); err != nil {
+				return err
+			}
+			item.Name, item.UnitPrice, item.Recipe = menuItem.Name, price, recipe
+		}
+		var err error
+		if item.LineTotal, err = item.UnitPrice.Mul(int64(item.Quantity)); err != nil {
+			return err
+		}
+		subtotal, err = subtotal.Add(item.LineTotal)
+		if err != nil {
+			return err
+		}
+		order.Items[n] = item
 	}
 
-	for _, items := range order.Items {
-		if exists := o.menuRepo.ExistsByID(items.ProductID); !exists {
-			return errorHandle.NotFoundID
+	order.Subtotal = subtotal
+	order.Total = subtotal
+	return nil
+}
+
+func findSnapshot(previous []models.OrderItem, item models.OrderItem) (models.OrderItem, bool) {
+	for _, old := range previous {
+		if !old.UnitPrice.IsZero() && old.SameSelection(item) {
+			return old, true
 		}
 	}
+	return models.OrderItem{}, false
+}
 
-	for _, item := range order.Items {
-		err := o.menuRepo.MenuCalcuation(item.ProductID, float64(item.Quantity))
+func (o *orderService) consume(tx dal.Tx, orderID string, items []models.OrderItem) error {
+	for _, item := range items {
+		err := o.menuRepo.MenuConsumptionOfIngredients(tx.Inventory(), item, false, models.ReasonOrderConsumption, orderID)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	for _, item := range order.Items {
-		err := o.menuRepo.MenuConsumptionOfIngredients(item.ProductID, float64(item.Quantity), false)
+func (o *orderService) refund(tx dal.Tx, orderID string, items []models.OrderItem) error {
+	for _, item := range items {
+		err := o.menuRepo.MenuConsumptionOfIngredients(tx.Inventory(), item, true, models.ReasonOrderCancellation, orderID)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	err = o.orderRepo.Update(order, id)
+// UpdateStatus закрывает заказ: проводит его по обычному пути до выдачи,
+// запоминая время каждого шага.
+func (o *orderService) UpdateStatus(id string) error {
+	return o.unitOfWork.Do(func(tx dal.Tx) error {
+		order, err := tx.Orders().GetItem(id)
+		if err != nil {
+			return err
+		}
+		if !order.Status.Active() {
+			return errorHandle.StatusExists
+		}
 
-	return err
+		for order.Status != models.StatusPickedUp {
+			order, err = tx.Orders().UpdateStatus(id, transitions[order.Status][0])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (o *orderService) Delete(id string) error {
-	order, err := o.orderRepo.GetItem(id)
-	if err != nil {
-		return err
-	}
-
-	if order.Status == "Close" {
-		return errorHandle.DeleteOrder
+// Transition переводит заказ в status по таблице transitions. При отмене
+// ингредиенты возвращаются на склад в той же транзакции.
+func (o *orderService) Transition(id string, status models.OrderStatus) (models.Order, error) {
+	if !knownStatus(status) {
+		return models.Order{}, errorHandle.InvalidStatus
 	}
 
-	for _, items := range order.Items {
-		err := o.menuRepo.MenuConsumptionOfIngredients(items.ProductID, float64(items.Quantity), true)
+	var result models.Order
+	err := o.unitOfWork.Do(func(tx dal.Tx) error {
+		order, err := tx.Orders().GetItem(id)
 		if err != nil {
 			return err
 		}
-	}
-
-	err = o.orderRepo.Delete(id)
-	return err
-}
+		if !canTransition(order.Status, status) {
+			return errorHandle.InvalidTransition
+		}
 
-func (o *orderService) UpdateStatus(id string) error {
-	err := o.orderRepo.UpdateStatus(id)
-	return err
+		if status == models.StatusCancelled {
+			if err := o.refund(tx, id, order.Items); err != nil {
+				return err
+			}
+		}
+		result, err = tx.Orders().UpdateStatus(id, status)
+		return err
+	})
+	return result, err
 }
 
-func (o *orderService) TotalSum() (float64, error) {
-	var sum float64
+// TotalSum складывает суммы всех заказов, кроме отменённых и возвращённых:
+// принятый заказ уже оплачен, даже если его ещё не выдали. Без продаж
+// выручка нулевая.
+func (o *orderService) TotalSum() (models.Money, error) {
+	var sum models.Money
 	orders, err := o.orderRepo.GetAll()
-	if err != nil {
-		return 0, err
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileOrders) {
+		return models.Money{}, err
 	}
 	for _, orderItem := range orders {
-		for _, item := range orderItem.Items {
-			priceItem, err := o.menuRepo.SumOfOrder(item.ProductID)
+		if !isSale(orderItem) {
+			continue
+		}
+		total, err := o.orderTotal(orderItem)
+		if err != nil {
+			return models.Money{}, err
+		}
+		sum, err = sum.Add(total)
+		if err != nil {
+			return models.Money{}, err
+		}
+	}
+	if sum.Currency == "" {
+		sum.Currency = models.DefaultCurrency
+	}
+	return sum, nil
+}
+
+// orderTotal берёт сумму, зафиксированную в заказе. Для заказов, созданных
+// до появления цен в заказе, сумма считается по текущему меню.
+func (o *orderService) orderTotal(order models.Order) (models.Money, error) {
+	if !order.Total.IsZero() {
+		return order.Total, nil
+	}
+
+	var total models.Money
+	for _, item := range order.Items {
+		price := item.UnitPrice
+		if price.IsZero() {
+			var err error
+			price, err = o.menuRepo.SumOfOrder(item.ProductID)
 			if err != nil {
-				return 0, err
+				return models.Money{}, err
 			}
-			sum += priceItem * float64(item.Quantity)
+		}
+		line, err := price.Mul(int64(item.Quantity))
+		if err != nil {
+			return models.Money{}, err
+		}
+		total, err = total.Add(line)
+		if err != nil {
+			return models.Money{}, err
 		}
 	}
-	return sum, nil
+	return total, nil
 }
 
+// MostPopularItem возвращает самое продаваемое блюдо; без продаж — пустую строку.
 func (o *orderService) MostPopularItem() (string, error) {
 	popularItem := GetPopularItem{
 		name:     "",
 		quantity: 0,
 	}
-	orders, err := o.GetAll()
-	if err != nil {
+	orders, err := o.orderRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileOrders) {
 		return "", err
 	}
 	for _, order := range orders {
+		if !isSale(order) {
+			continue
+		}
 		for _, item := range order.Items {
 			if item.Quantity > popularItem.quantity {
 				popularItem.name = item.ProductID
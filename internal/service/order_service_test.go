@@ -0,0 +1,70 @@
+package service
+
+import (
+	"hot-coffee/internal/dal"
+	"hot-coffee/models"
+	"testing"
+)
+
+func TestTotalSum(t *testing.T) {
+	ids, err := dal.NewIDGenerator(dal.IDSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := dal.Config{Storage: dal.StorageJSON, Dir: t.TempDir(), OrderIDs: ids}
+	err = dal.Seed(cfg, dal.Dataset{
+		Inventory: []models.InventoryItem{{IngredientID: "milk", Name: "Milk", Quantity: 5000, Unit: "ml"}},
+		Menu: []models.MenuItem{{
+			ID:          "latte",
+			Name:        "Latte",
+			Description: "Espresso with milk",
+			Price:       models.Money{Amount: 350, Currency: models.DefaultCurrency},
+			Category:    models.CategoryHotDrinks,
+			Ingredients: []models.MenuItemIngredient{{IngredientID: "milk", Quantity: 200, Unit: "ml"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := dal.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	orders := NewOrderService(store.Orders, store.Menu, store.Inventory, store.UnitOfWork)
+
+	// Каждому заказу — путь по статусам. В выручку идут все, кроме
+	// отменённых и возвращённых.
+	paths := [][]models.OrderStatus{
+		nil,
+		{models.StatusInPreparation, models.StatusReady},
+		{models.StatusInPreparation, models.StatusReady, models.StatusPickedUp},
+		{models.StatusCancelled},
+		{models.StatusInPreparation, models.StatusReady, models.StatusPickedUp, models.StatusRefunded},
+	}
+	for n, path := range paths {
+		order := models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: n + 1}}}
+		if err := orders.Create(order); err != nil {
+			t.Fatal(err)
+		}
+		created, err := store.Orders.GetAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := created[len(created)-1].ID
+		for _, status := range path {
+			if _, err := orders.Transition(id, status); err != nil {
+				t.Fatalf("order %d to %s: %v", n, status, err)
+			}
+		}
+	}
+
+	got, err := orders.TotalSum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Money{Amount: 350 * (1 + 2 + 3), Currency: models.DefaultCurrency}
+	if got != want {
+		t.Errorf("TotalSum() = %v, want %v", got, want)
+	}
+}
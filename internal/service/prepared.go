@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+	"math"
+)
+
+// requirement — количество ингредиента в его единицах склада.
+type requirement struct {
+	id       string
+	quantity float64
+}
+
+// maxPortions — верхняя граница поиска порций, чтобы не зациклиться на
+// рецептах из одних бесконечно малых количеств.
+const maxPortions = 1 << 30
+
+// stockIndex возвращает неархивные ингредиенты склада по ID.
+func stockIndex(inventoryRepo dal.InventoryRepository) (map[string]models.InventoryItem, error) {
+	items, err := inventoryRepo.GetAll()
+	if err != nil && !errors.Is(err, errorHandle.EmptyFileInventory) {
+		return nil, err
+	}
+	index := make(map[string]models.InventoryItem, len(items))
+	for _, item := range items {
+		if item.Archived() {
+			continue
+		}
+		index[item.IngredientID] = item
+	}
+	return index, nil
+}
+
+// inputsOf переводит рецепт заготовки на quantity её единиц в количества
+// входящих ингредиентов.
+func inputsOf(item models.InventoryItem, quantity float64, stock map[string]models.InventoryItem) ([]requirement, error) {
+	scale := quantity / item.Recipe.Yield
+	result := make([]requirement, 0, len(item.Recipe.Ingredients))
+	for _, line := range item.Recipe.Ingredients {
+		input, ok := stock[line.IngredientID]
+		if !ok {
+			return nil, errorHandle.UnknownIngredient
+		}
+		amount, err := models.ConvertQuantity(line.Quantity*scale, line.Unit, input.Unit)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, requirement{id: line.IngredientID, quantity: amount})
+	}
+	return result, nil
+}
+
+// findCycle возвращает RecipeCycle, если рецепт заготовки id через другие
+// заготовки ссылается сам на себя.
+func findCycle(id string, stock map[string]models.InventoryItem) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return errorHandle.RecipeCycle
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		if item, ok := stock[id]; ok && item.Prepared() {
+			for _, line := range item.Recipe.Ingredients {
+				if err := visit(line.IngredientID); err != nil {
+					return err
+				}
+			}
+		}
+		state[id] = done
+		return nil
+	}
+	return visit(id)
+}
+
+// topoOrder упорядочивает ингредиенты дерева рецептов так, что заготовка
+// идёт раньше своих ингредиентов. Дерево без циклов проверено при записи.
+func topoOrder(roots []requirement, stock map[string]models.InventoryItem) []string {
+	seen := make(map[string]bool)
+	var order []string
+
+	var visit func(id string)
+	visit = func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		if item, ok := stock[id]; ok && item.Prepared() {
+			for _, line := range item.Recipe.Ingredients {
+				visit(line.IngredientID)
+			}
+		}
+		order = append(order, id)
+	}
+	// Обход с конца, чтобы после разворота корни шли в порядке рецепта.
+	for n := len(roots) - 1; n >= 0; n-- {
+		visit(roots[n].id)
+	}
+
+	for a, b := 0, len(order)-1; a < b; a, b = a+1, b-1 {
+		order[a], order[b] = order[b], order[a]
+	}
+	return order
+}
+
+// shortage проверяет, хватит ли склада на portions порций рецепта need.
+// С produce нехватку заготовки покрывает её приготовление из остатков
+// ингредиентов. Возвращает ингредиент, которого не хватило.
+func shortage(need []requirement, portions float64, stock map[string]models.InventoryItem, produce bool) (string, bool) {
+	demand := make(map[string]float64)
+	for _, line := range need {
+		demand[line.id] += line.quantity * portions
+	}
+
+	for _, id := range topoOrder(need, stock) {
+		wanted := demand[id]
+		if wanted <= 0 {
+			continue
+		}
+		item, ok := stock[id]
+		if !ok {
+			return id, true
+		}
+		// Допуск гасит погрешность деления (0.3 / 0.1 = 2.9999…).
+		short := wanted - item.Quantity
+		if short <= 1e-9*math.Max(1, wanted) {
+			continue
+		}
+		if !produce || !item.Prepared() {
+			return id, true
+		}
+		inputs, err := inputsOf(item, short, stock)
+		if err != nil {
+			return id, true
+		}
+		for _, input := range inputs {
+			demand[input.id] += input.quantity
+		}
+	}
+	return "", false
+}
+
+// portions ищет наибольшее число порций, на которое хватит склада, и
+// ингредиент, который кончится первым.
+func portions(need []requirement, stock map[string]models.InventoryItem, produce bool) (int, string) {
+	if limiting, short := shortage(need, 1, stock, produce); short {
+		return 0, limiting
+	}
+
+	low, high := 1, 2
+	for high < maxPortions {
+		if _, short := shortage(need, float64(high), stock, produce); short {
+			break
+		}
+		low, high = high, high*2
+	}
+	if high >= maxPortions {
+		return maxPortions, ""
+	}
+	for high-low > 1 {
+		middle := (low + high) / 2
+		if _, short := shortage(need, float64(middle), stock, produce); short {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	limiting, _ := shortage(need, float64(high), stock, produce)
+	return low, limiting
+}
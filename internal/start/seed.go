@@ -0,0 +1,197 @@
+package start
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/dal"
+	"hot-coffee/models"
+	"log/slog"
+	"os"
+)
+
+// PrepareDir открывает каталог с данными. Сид-данные записываются только в
+// пустой каталог или по явному флагу --seed / --reset.
+func PrepareDir(cfg Config) error {
+	if cfg.Reset {
+		slog.Warn("Resetting data directory", slog.String("dir", cfg.Dir))
+		if err := os.RemoveAll(cfg.Dir); err != nil {
+			return err
+		}
+	}
+
+	empty, err := isEmptyDir(cfg.Dir)
+	if err != nil {
+		return err
+	}
+	if empty {
+		fmt.Println("Папка пуста или не существует. Создаем!")
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return err
+	}
+
+	if empty || cfg.Seed || cfg.Reset {
+		fixture, err := LoadFixture(cfg.SeedFile)
+		if err != nil {
+			return err
+		}
+		slog.Info("Seeding data directory", slog.String("dir", cfg.Dir), slog.String("storage", cfg.Storage))
+		return dal.Seed(dal.Config{Storage: cfg.Storage, Dir: cfg.Dir}, fixture)
+	}
+
+	if cfg.Storage == dal.StorageJSON {
+		return createMissingFiles(cfg.Dir)
+	}
+	return nil
+}
+
+func LoadFixture(path string) (dal.Dataset, error) {
+	if path == "" {
+		return defaultFixture(), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return dal.Dataset{}, err
+	}
+
+	var fixture dal.Dataset
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return dal.Dataset{}, fmt.Errorf("seed file %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+func createMissingFiles(dir string) error {
+	for _, path := range dal.JSONFiles(dir) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		// Файл мог потеряться при сбое — тогда его восстановит загрузка из .bak.
+		if _, err := os.Stat(path + ".bak"); err == nil {
+			continue
+		}
+		if err := dal.WriteJSON(path, []struct{}{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return len(entries) == 0, nil
+}
+
+func defaultFixture() dal.Dataset {
+	return dal.Dataset{
+		Inventory: []models.InventoryItem{
+			{IngredientID: "espresso_shot", Name: "Espresso Shot", Quantity: 500, Unit: "shots", ReorderPoint: 100, ParLevel: 500},
+			{IngredientID: "milk", Name: "Milk", Quantity: 5000, Unit: "ml", ReorderPoint: 1000, ParLevel: 5000},
+			{IngredientID: "oat_milk", Name: "Oat Milk", Quantity: 2000, Unit: "ml", ReorderPoint: 500, ParLevel: 2000},
+			{IngredientID: "flour", Name: "Flour", Quantity: 10000, Unit: "g", ReorderPoint: 2000, ParLevel: 10000},
+			{IngredientID: "blueberries", Name: "Blueberries", Quantity: 2000, Unit: "g", ReorderPoint: 400, ParLevel: 2000},
+			{IngredientID: "sugar", Name: "Sugar", Quantity: 5000, Unit: "g", ReorderPoint: 1000, ParLevel: 5000},
+			{IngredientID: "water", Name: "Water", Quantity: 20000, Unit: "ml"},
+			{IngredientID: "vanilla_extract", Name: "Vanilla Extract", Quantity: 200, Unit: "ml", ReorderPoint: 40, ParLevel: 200},
+			{
+				IngredientID: "vanilla_syrup",
+				Name:         "Vanilla Syrup",
+				Quantity:     500,
+				Unit:         "ml",
+				ReorderPoint: 200,
+				ParLevel:     1000,
+				Recipe: &models.PreparedRecipe{
+					Yield: 1000,
+					Ingredients: []models.MenuItemIngredient{
+						{IngredientID: "sugar", Quantity: 800, Unit: "g"},
+						{IngredientID: "water", Quantity: 600, Unit: "ml"},
+						{IngredientID: "vanilla_extract", Quantity: 20, Unit: "ml"},
+					},
+				},
+			},
+		},
+		Menu: []models.MenuItem{
+			{
+				ID:          "latte",
+				Name:        "Caffe Latte",
+				Description: "Espresso with steamed milk",
+				Price:       models.Money{Amount: 350, Currency: "USD"},
+				Category:    models.CategoryHotDrinks,
+				Tags:        []string{"coffee", "milk"},
+				SortOrder:   2,
+				Ingredients: []models.MenuItemIngredient{
+					{IngredientID: "espresso_shot", Quantity: 1, Unit: "shots"},
+					{IngredientID: "milk", Quantity: 200, Unit: "ml"},
+				},
+				Variants: []models.VariantGroup{
+					{
+						Name:    "size",
+						Default: "M",
+						Options: []models.Variant{
+							{ID: "S", Multiplier: 0.75, PriceDelta: models.Money{Amount: -50, Currency: "USD"}},
+							{ID: "M"},
+							{ID: "L", Multiplier: 1.5, PriceDelta: models.Money{Amount: 70, Currency: "USD"}},
+						},
+					},
+				},
+				Modifiers: []models.Modifier{
+					{
+						ID:         "oat_milk",
+						Name:       "Oat milk",
+						PriceDelta: models.Money{Amount: 50, Currency: "USD"},
+						Replace:    []models.Substitution{{From: "milk", To: "oat_milk"}},
+					},
+					{
+						ID:         "extra_shot",
+						Name:       "Extra espresso shot",
+						PriceDelta: models.Money{Amount: 60, Currency: "USD"},
+						Add:        []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1, Unit: "shots"}},
+					},
+					{
+						ID:         "vanilla",
+						Name:       "Vanilla syrup",
+						PriceDelta: models.Money{Amount: 40, Currency: "USD"},
+						Add:        []models.MenuItemIngredient{{IngredientID: "vanilla_syrup", Quantity: 20, Unit: "ml"}},
+					},
+				},
+			},
+			{
+				ID:          "muffin",
+				Name:        "Blueberry Muffin",
+				Description: "Freshly baked muffin with blueberries",
+				Price:       models.Money{Amount: 200, Currency: "USD"},
+				Category:    models.CategoryPastries,
+				Tags:        []string{"breakfast"},
+				SortOrder:   3,
+				Ingredients: []models.MenuItemIngredient{
+					{IngredientID: "flour", Quantity: 100, Unit: "g"},
+					{IngredientID: "blueberries", Quantity: 20, Unit: "g"},
+					{IngredientID: "sugar", Quantity: 30, Unit: "g"},
+				},
+				Modifiers: []models.Modifier{
+					{ID: "no_sugar", Name: "No sugar", Remove: []string{"sugar"}},
+				},
+			},
+			{
+				ID:          "espresso",
+				Name:        "Espresso",
+				Description: "Strong and bold coffee",
+				Price:       models.Money{Amount: 250, Currency: "USD"},
+				Category:    models.CategoryHotDrinks,
+				Tags:        []string{"coffee"},
+				SortOrder:   1,
+				Ingredients: []models.MenuItemIngredient{
+					{IngredientID: "espresso_shot", Quantity: 1, Unit: "shots"},
+				},
+			},
+		},
+	}
+}
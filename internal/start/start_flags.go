@@ -13,23 +13,51 @@ import (
 	"strings"
 )
 
+type Config struct {
+	Port     int
+	Dir      string
+	Seed     bool
+	Reset    bool
+	SeedFile string
+	OrderID  string
+	Storage  string
+
+	AlertWebhook string
+	AlertFile    string
+}
+
 func Help() {
-	fmt.Print(`Simple Storage Service.
+	fmt.Print(`Hot Coffee.
 
 **Usage:**
-    triple-s [-port <N>] [-dir <S>]  
-    triple-s --help
+    hot-coffee [-port <N>] [-dir <S>] [--seed] [--reset] [--seed-file <F>] [--order-id <T>] [--storage <B>]
+               [--alert-webhook <URL>] [--alert-file <F>]
+    hot-coffee --help
 
 **Options:**
-- --help     Show this screen.
-- --port N   Port number
-- --dir S    Path to the directory`, "\n")
+- --help          Show this screen.
+- --port N        Port number
+- --dir S         Path to the directory
+- --seed          Write seed data into the directory even if it already has data
+- --reset         Delete the directory and start from seed data
+- --seed-file F   Seed from the JSON fixture F instead of the built-in data
+- --order-id T    Order ID strategy: sequential (default), ulid or uuidv7
+- --storage B     Storage backend: json (default) or sqlite
+- --alert-webhook URL  POST low-stock alerts as JSON to URL
+- --alert-file F       Append low-stock alerts as JSON lines to F`, "\n")
 }
 
-func AllFlags() (int, string) {
+func AllFlags() Config {
 	helpFlag := flag.Bool("help", false, "help")
 	portFlag := flag.Int("port", 8080, "port")
 	dirFlag := flag.String("dir", "data", "dir")
+	seedFlag := flag.Bool("seed", false, "seed")
+	resetFlag := flag.Bool("reset", false, "reset")
+	seedFileFlag := flag.String("seed-file", "", "seed-file")
+	orderIDFlag := flag.String("order-id", "sequential", "order-id")
+	storageFlag := flag.String("storage", "json", "storage")
+	alertWebhookFlag := flag.String("alert-webhook", "", "alert-webhook")
+	alertFileFlag := flag.String("alert-file", "", "alert-file")
 	flag.Usage = Help
 	flag.Parse()
 
@@ -46,8 +74,23 @@ func AllFlags() (int, string) {
 		fmt.Fprintf(os.Stderr, "This name isn't a valid\n")
 		os.Exit(1)
 	}
+	if *storageFlag != "json" && *storageFlag != "sqlite" {
+		fmt.Fprintf(os.Stderr, "Unknown storage: %s\n", *storageFlag)
+		os.Exit(1)
+	}
+
+	return Config{
+		Port:     *portFlag,
+		Dir:      *dirFlag,
+		Seed:     *seedFlag,
+		Reset:    *resetFlag,
+		SeedFile: *seedFileFlag,
+		OrderID:  *orderIDFlag,
+		Storage:  *storageFlag,
 
-	return *portFlag, *dirFlag
+		AlertWebhook: *alertWebhookFlag,
+		AlertFile:    *alertFileFlag,
+	}
 }
 
 func isValidPort(portNum int) bool {
@@ -85,143 +128,6 @@ func IsValidName(name string) bool {
 	return re.MatchString(name)
 }
 
-func CreateDir(dirFlag string) {
-	_, err := os.Stat(dirFlag)
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("Папка не существует. Создаем!")
-		}
-	} else {
-		_ = os.RemoveAll(dirFlag)
-	}
-
-	_ = os.Mkdir(dirFlag, 0o766)
-
-	ingredients := []map[string]interface{}{
-		{
-			"ingredient_id": "espresso_shot",
-			"name":          "Espresso Shot",
-			"quantity":      500,
-			"unit":          "shots",
-		},
-		{
-			"ingredient_id": "milk",
-			"name":          "Milk",
-			"quantity":      5000,
-			"unit":          "ml",
-		},
-		{
-			"ingredient_id": "flour",
-			"name":          "Flour",
-			"quantity":      10000,
-			"unit":          "g",
-		},
-		{
-			"ingredient_id": "blueberries",
-			"name":          "Blueberries",
-			"quantity":      2000,
-			"unit":          "g",
-		},
-		{
-			"ingredient_id": "sugar",
-			"name":          "Sugar",
-			"quantity":      5000,
-			"unit":          "g",
-		},
-	}
-
-	file, err := os.Create(dirFlag + "/inventory.json")
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
-	jsonData, err := json.MarshalIndent(ingredients, "", "  ")
-	if err != nil {
-		return
-	}
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		return
-	}
-
-	products := []map[string]interface{}{
-		{
-			"product_id":  "latte",
-			"name":        "Caffe Latte",
-			"description": "Espresso with steamed milk",
-			"price":       3.50,
-			"ingredients": []map[string]interface{}{
-				{
-					"ingredient_id": "espresso_shot",
-					"quantity":      1,
-				},
-				{
-					"ingredient_id": "milk",
-					"quantity":      200,
-				},
-			},
-		},
-		{
-			"product_id":  "muffin",
-			"name":        "Blueberry Muffin",
-			"description": "Freshly baked muffin with blueberries",
-			"price":       2.00,
-			"ingredients": []map[string]interface{}{
-				{
-					"ingredient_id": "flour",
-					"quantity":      100,
-				},
-				{
-					"ingredient_id": "blueberries",
-					"quantity":      20,
-				},
-				{
-					"ingredient_id": "sugar",
-					"quantity":      30,
-				},
-			},
-		},
-		{
-			"product_id":  "espresso",
-			"name":        "Espresso",
-			"description": "Strong and bold coffee",
-			"price":       2.50,
-			"ingredients": []map[string]interface{}{
-				{
-					"ingredient_id": "espresso_shot",
-					"quantity":      1,
-				},
-			},
-		},
-	}
-
-	file1, err1 := os.Create(dirFlag + "/menu_items.json")
-	if err1 != nil {
-		fmt.Println("Error creating file:", err1)
-		return
-	}
-	defer file1.Close()
-
-	jsonData1, err1 := json.MarshalIndent(products, "", "  ")
-	if err != nil {
-		fmt.Println("Error marshalling data:", err)
-		return
-	}
-
-	_, err = file1.Write(jsonData1)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return
-	}
-	file2, err2 := os.Create(dirFlag + "/orders.json")
-	if err2 != nil {
-		return
-	}
-	file2.Close()
-}
-
 func ChangeJsonFile() {
 	filePath := "data/menu_items.json"
 	file, err := ioutil.ReadFile(filePath)
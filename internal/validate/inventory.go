@@ -0,0 +1,63 @@
+package validate
+
+import (
+	"fmt"
+	"hot-coffee/models"
+)
+
+// InventoryItem проверяет поля ингредиента склада. Наличие ингредиентов
+// рецепта заготовки и циклы проверяет сервис склада.
+func InventoryItem(item models.InventoryItem) error {
+	var v Errors
+	v.ID("ingredient_id", item.IngredientID)
+	v.Text("name", item.Name, maxNameLength)
+	v.NotNegative("quantity", item.Quantity)
+	v.Unit("unit", item.Unit, true)
+
+	v.NotNegative("reorder_point", item.ReorderPoint)
+	v.NotNegative("par_level", item.ParLevel)
+	if item.ParLevel > 0 && item.ParLevel < item.ReorderPoint {
+		v.Add("par_level", CodeOutOfRange, "must not be below reorder_point")
+	}
+
+	if item.Recipe != nil {
+		v.Positive("recipe.yield", item.Recipe.Yield)
+		if len(item.Recipe.Ingredients) == 0 {
+			v.Add("recipe.ingredients", CodeRequired, "at least one ingredient is required")
+		}
+		v.Recipe("recipe.ingredients", item.Recipe.Ingredients)
+	}
+	return v.Err()
+}
+
+// StockAdjustment проверяет ручное изменение остатка. Причину проверяет
+// сервис склада: движения по заказам вручную не пишутся.
+func StockAdjustment(adjustment models.StockAdjustment) error {
+	var v Errors
+	if adjustment.Delta == 0 {
+		v.Add("delta", CodeRequired, "must not be zero")
+	}
+	return v.Err()
+}
+
+// Restock проверяет поставку: каждый ингредиент с положительным количеством.
+func Restock(restock models.Restock) error {
+	var v Errors
+	if len(restock.Items) == 0 {
+		v.Add("items", CodeRequired, "at least one item is required")
+	}
+	for n, delivery := range restock.Items {
+		prefix := fmt.Sprintf("items[%d]", n)
+		v.ID(prefix+".ingredient_id", delivery.IngredientID)
+		v.Positive(prefix+".quantity", delivery.Quantity)
+	}
+	return v.Err()
+}
+
+// Production проверяет партию заготовки: нулевое количество означает одну
+// партию по рецепту.
+func Production(production models.Production) error {
+	var v Errors
+	v.NotNegative("quantity", production.Quantity)
+	return v.Err()
+}
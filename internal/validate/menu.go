@@ -0,0 +1,120 @@
+package validate
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"strings"
+)
+
+// MenuItem проверяет поля блюда, его варианты и модификаторы. Наличие
+// ингредиентов на складе и перевод единиц проверяет сервис меню.
+func MenuItem(item models.MenuItem) error {
+	var v Errors
+	v.ID("product_id", item.ID)
+	v.Text("name", item.Name, maxNameLength)
+	v.Text("description", item.Description, maxDescriptionLength)
+	if item.Price.Amount <= 0 {
+		v.Add("price", CodeNotPositive, "must be greater than zero")
+	}
+
+	if len(item.Ingredients) == 0 {
+		v.Add("ingredients", CodeRequired, "at least one ingredient is required")
+	}
+	v.Recipe("ingredients", item.Ingredients)
+
+	if !item.Category.Valid() {
+		v.Add("category", CodeInvalid, "must be one of hot_drinks, cold_drinks, pastries")
+	}
+	for n, tag := range item.Tags {
+		field := fmt.Sprintf("tags[%d]", n)
+		v.Text(field, strings.TrimSpace(tag), maxTagLength)
+	}
+	if err := item.Available.Validate(); err != nil {
+		v.Add("availability", CodeInvalid, err.Error())
+	}
+
+	v.variants(item)
+	v.modifiers(item)
+	if len(v) == 0 {
+		if _, price, err := item.Recipe(nil, nil); err == nil && price.Amount <= 0 {
+			v.Add("price", CodeNotPositive, "must be greater than zero with default options")
+		}
+	}
+	return v.Err()
+}
+
+func (v *Errors) variants(item models.MenuItem) {
+	groups := make(map[string]bool, len(item.Variants))
+	for n, group := range item.Variants {
+		prefix := fmt.Sprintf("variants[%d]", n)
+		v.Text(prefix+".name", group.Name, maxNameLength)
+		if group.Name != "" && groups[group.Name] {
+			v.Add(prefix+".name", CodeDuplicate, "group is listed more than once")
+		}
+		groups[group.Name] = true
+
+		if len(group.Options) == 0 {
+			v.Add(prefix+".options", CodeRequired, "at least one option is required")
+		}
+		options := make(map[string]bool, len(group.Options))
+		for k, option := range group.Options {
+			field := fmt.Sprintf("%s.options[%d]", prefix, k)
+			v.ID(field+".id", option.ID)
+			if option.ID != "" && options[option.ID] {
+				v.Add(field+".id", CodeDuplicate, "option is listed more than once")
+			}
+			options[option.ID] = true
+			v.NotNegative(field+".multiplier", option.Multiplier)
+			v.currency(field+".price_delta", item.Price, option.PriceDelta)
+		}
+		switch {
+		case group.Default == "":
+			v.Add(prefix+".default", CodeRequired, "is required")
+		case len(group.Options) > 0 && !options[group.Default]:
+			v.Add(prefix+".default", CodeInvalid, "must be one of the options")
+		}
+	}
+}
+
+func (v *Errors) modifiers(item models.MenuItem) {
+	modifiers := make(map[string]bool, len(item.Modifiers))
+	for n, modifier := range item.Modifiers {
+		prefix := fmt.Sprintf("modifiers[%d]", n)
+		v.ID(prefix+".id", modifier.ID)
+		if modifier.ID != "" && modifiers[modifier.ID] {
+			v.Add(prefix+".id", CodeDuplicate, "modifier is listed more than once")
+		}
+		modifiers[modifier.ID] = true
+		v.currency(prefix+".price_delta", item.Price, modifier.PriceDelta)
+
+		for k, id := range modifier.Remove {
+			if !inRecipe(item.Ingredients, id) {
+				v.Add(fmt.Sprintf("%s.remove[%d]", prefix, k), CodeInvalid, "ingredient is not in the recipe")
+			}
+		}
+		for k, substitution := range modifier.Replace {
+			field := fmt.Sprintf("%s.replace[%d]", prefix, k)
+			if !inRecipe(item.Ingredients, substitution.From) {
+				v.Add(field+".from", CodeInvalid, "ingredient is not in the recipe")
+			}
+			v.ID(field+".to", substitution.To)
+		}
+		v.Recipe(prefix+".add", modifier.Add)
+	}
+}
+
+// currency проверяет, что надбавка в валюте цены блюда.
+func (v *Errors) currency(field string, price, delta models.Money) {
+	if _, err := price.Add(delta); err != nil {
+		v.Add(field, CodeInvalid, "must be in the currency of price")
+	}
+}
+
+func inRecipe(ingredients []models.MenuItemIngredient, id string) bool {
+	for _, ingredient := range ingredients {
+		if ingredient.IngredientID == id {
+			return true
+		}
+	}
+	return false
+}
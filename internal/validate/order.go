@@ -0,0 +1,80 @@
+package validate
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"slices"
+)
+
+// maxItemQuantity ограничивает количество одной позиции заказа.
+const maxItemQuantity = 1000
+
+// NewOrder проверяет заказ при создании: его номер выдаёт сервер.
+func NewOrder(order models.Order) error {
+	var v Errors
+	if order.ID != "" {
+		v.Add("order_id", CodeReadOnly, "is assigned by the server")
+	}
+	v.order(order)
+	return v.Err()
+}
+
+// Order проверяет поля заказа, которые задаёт клиент. Статус и время
+// заказа выставляет сервер, суммы пересчитываются.
+func Order(order models.Order) error {
+	var v Errors
+	v.order(order)
+	return v.Err()
+}
+
+// OrderPatch проверяет заказ после PATCH: поля, которые задаёт сервер,
+// должны остаться такими, как в сохранённом заказе.
+func OrderPatch(old, order models.Order) error {
+	var v Errors
+	if order.Status != old.Status {
+		v.Add("status", CodeReadOnly, "is changed only through transitions")
+	}
+	if !slices.Equal(order.StatusHistory, old.StatusHistory) {
+		v.Add("status_history", CodeReadOnly, "is recorded by the server")
+	}
+	if order.CreatedAt != old.CreatedAt {
+		v.Add("created_at", CodeReadOnly, "is assigned by the server")
+	}
+	order.Status, order.StatusHistory, order.CreatedAt = "", nil, ""
+	v.order(order)
+	return v.Err()
+}
+
+func (v *Errors) order(order models.Order) {
+	if order.Status != "" {
+		v.Add("status", CodeReadOnly, "is changed only through transitions")
+	}
+	if len(order.StatusHistory) > 0 {
+		v.Add("status_history", CodeReadOnly, "is recorded by the server")
+	}
+	if order.CreatedAt != "" {
+		v.Add("created_at", CodeReadOnly, "is assigned by the server")
+	}
+	v.Text("customer_name", order.CustomerName, maxNameLength)
+
+	if len(order.Items) == 0 {
+		v.Add("items", CodeRequired, "at least one item is required")
+	}
+	for n, item := range order.Items {
+		prefix := fmt.Sprintf("items[%d]", n)
+		v.ID(prefix+".product_id", item.ProductID)
+		switch {
+		case item.Quantity <= 0:
+			v.Add(prefix+".quantity", CodeNotPositive, "must be greater than zero")
+		case item.Quantity > maxItemQuantity:
+			v.Add(prefix+".quantity", CodeOutOfRange, fmt.Sprintf("must be at most %d", maxItemQuantity))
+		}
+
+		for _, previous := range order.Items[:n] {
+			if previous.SameSelection(item) {
+				v.Add(prefix, CodeDuplicate, "same product and options are listed more than once")
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package validate проверяет поля запросов целиком и собирает все ошибки,
+// а не только первую.
+package validate
+
+import (
+	"fmt"
+	"hot-coffee/internal/errorHandle"
+	"hot-coffee/models"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Коды ошибок полей.
+const (
+	CodeRequired     = "required"
+	CodeTooLong      = "too_long"
+	CodeInvalid      = "invalid_format"
+	CodeNotPositive  = "not_positive"
+	CodeNegative     = "negative"
+	CodeOutOfRange   = "out_of_range"
+	CodeDuplicate    = "duplicate"
+	CodeUnknownUnit  = "unknown_unit"
+	CodeUnknownField = "unknown_field"
+	CodeInvalidType  = "invalid_type"
+	CodeReadOnly     = "read_only"
+)
+
+const (
+	maxIDLength          = 64
+	maxNameLength        = 100
+	maxDescriptionLength = 500
+	maxTagLength         = 32
+)
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Errors накапливает ошибки полей.
+type Errors []errorHandle.Detail
+
+func (v *Errors) Add(field, code, message string) {
+	*v = append(*v, errorHandle.Detail{Field: field, Code: code, Message: message})
+}
+
+// Err возвращает ValidationFailed со всеми ошибками или nil.
+func (v Errors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return errorHandle.ValidationFailed.WithDetails(v...)
+}
+
+func (v *Errors) ID(field, value string) {
+	switch {
+	case value == "":
+		v.Add(field, CodeRequired, "is required")
+	case len(value) > maxIDLength:
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", maxIDLength))
+	case !idPattern.MatchString(value):
+		v.Add(field, CodeInvalid, "may contain only letters, digits, '_' and '-'")
+	}
+}
+
+func (v *Errors) Text(field, value string, max int) {
+	switch {
+	case value == "":
+		v.Add(field, CodeRequired, "is required")
+	case utf8.RuneCountInString(value) > max:
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func (v *Errors) Positive(field string, value float64) {
+	if value <= 0 {
+		v.Add(field, CodeNotPositive, "must be greater than zero")
+	}
+}
+
+func (v *Errors) NotNegative(field string, value float64) {
+	if value < 0 {
+		v.Add(field, CodeNegative, "must not be negative")
+	}
+}
+
+func (v *Errors) Unit(field, value string, required bool) {
+	if value == "" {
+		if required {
+			v.Add(field, CodeRequired, "is required")
+		}
+		return
+	}
+	if _, err := models.LookupUnit(value); err != nil {
+		v.Add(field, CodeUnknownUnit, "unknown unit of measure")
+	}
+}
+
+// Recipe проверяет строки рецепта: ID, количество, единицу и повторы
+// ингредиента.
+func (v *Errors) Recipe(field string, lines []models.MenuItemIngredient) {
+	seen := make(map[string]bool, len(lines))
+	for n, line := range lines {
+		prefix := fmt.Sprintf("%s[%d]", field, n)
+		v.ID(prefix+".ingredient_id", line.IngredientID)
+		v.Positive(prefix+".quantity", line.Quantity)
+		v.Unit(prefix+".unit", line.Unit, false)
+
+		if line.IngredientID != "" && seen[line.IngredientID] {
+			v.Add(prefix+".ingredient_id", CodeDuplicate, "ingredient is listed more than once")
+		}
+		seen[line.IngredientID] = true
+	}
+}
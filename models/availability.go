@@ -0,0 +1,118 @@
+package models
+
+import (
+	"hot-coffee/internal/errorHandle"
+	"strings"
+	"time"
+)
+
+type Category string
+
+const (
+	CategoryHotDrinks  Category = "hot_drinks"
+	CategoryColdDrinks Category = "cold_drinks"
+	CategoryPastries   Category = "pastries"
+)
+
+func (c Category) Valid() bool {
+	switch c {
+	case "", CategoryHotDrinks, CategoryColdDrinks, CategoryPastries:
+		return true
+	}
+	return false
+}
+
+// Availability — когда блюдо можно заказать. Пустое поле не ограничивает.
+// Время суток задаётся как "07:00" (Until не включается; окно может
+// переходить через полночь), даты — как "2024-09-01" включительно.
+type Availability struct {
+	Days      []string `json:"days,omitempty"` // "mon" … "sun"
+	From      string   `json:"from,omitempty"`
+	Until     string   `json:"until,omitempty"`
+	StartDate string   `json:"start_date,omitempty"`
+	EndDate   string   `json:"end_date,omitempty"`
+}
+
+const (
+	clockLayout = "15:04"
+	dateLayout  = "2006-01-02"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (a *Availability) Validate() error {
+	if a == nil {
+		return nil
+	}
+	for _, day := range a.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return errorHandle.InvalidAvailability
+		}
+	}
+	if (a.From == "") != (a.Until == "") {
+		return errorHandle.InvalidAvailability
+	}
+	for _, clock := range []string{a.From, a.Until} {
+		if _, ok := minutes(clock); clock != "" && !ok {
+			return errorHandle.InvalidAvailability
+		}
+	}
+	for _, date := range []string{a.StartDate, a.EndDate} {
+		if _, err := time.Parse(dateLayout, date); date != "" && err != nil {
+			return errorHandle.InvalidAvailability
+		}
+	}
+	if a.StartDate != "" && a.EndDate != "" && a.StartDate > a.EndDate {
+		return errorHandle.InvalidAvailability
+	}
+	return nil
+}
+
+// AvailableAt сообщает, можно ли заказать блюдо в момент t (местное время).
+func (a *Availability) AvailableAt(t time.Time) bool {
+	if a == nil {
+		return true
+	}
+
+	date := t.Format(dateLayout)
+	if a.StartDate != "" && date < a.StartDate || a.EndDate != "" && date > a.EndDate {
+		return false
+	}
+
+	if len(a.Days) > 0 {
+		found := false
+		for _, day := range a.Days {
+			if weekdays[strings.ToLower(day)] == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if a.From != "" {
+		from, _ := minutes(a.From)
+		until, _ := minutes(a.Until)
+		clock := t.Hour()*60 + t.Minute()
+		if from <= until {
+			return clock >= from && clock < until
+		}
+		return clock >= from || clock < until
+	}
+	return true
+}
+
+// minutes переводит "HH:MM" в минуты от полуночи. Допускается только
+// ровно две цифры часа: time.Parse принимает и "7:00".
+func minutes(clock string) (int, bool) {
+	t, err := time.Parse(clockLayout, clock)
+	if err != nil || t.Format(clockLayout) != clock {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
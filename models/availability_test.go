@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAvailabilityWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		moment, err := time.ParseInLocation("2006-01-02 15:04", "2024-09-02 "+clock, time.Local)
+		if err != nil {
+			panic(err)
+		}
+		return moment
+	}
+
+	tests := []struct {
+		name        string
+		from, until string
+		valid       bool
+		open        map[string]bool
+	}{
+		{
+			name: "morning", from: "07:00", until: "11:00", valid: true,
+			open: map[string]bool{"06:59": false, "07:00": true, "09:30": true, "10:59": true, "11:00": false, "23:00": false},
+		},
+		{
+			name: "past midnight", from: "22:00", until: "02:00", valid: true,
+			open: map[string]bool{"21:59": false, "22:00": true, "23:59": true, "00:00": true, "01:59": true, "02:00": false, "12:00": false},
+		},
+		{name: "single digit from", from: "7:00", until: "11:00"},
+		{name: "single digit until", from: "07:00", until: "9:30"},
+		{name: "out of range", from: "24:00", until: "02:00"},
+		{name: "only from", from: "07:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Availability{From: test.from, Until: test.until}
+			if err := a.Validate(); (err == nil) != test.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, test.valid)
+			}
+			for clock, want := range test.open {
+				if got := a.AvailableAt(at(clock)); got != want {
+					t.Errorf("AvailableAt(%s) = %v, want %v", clock, got, want)
+				}
+			}
+		})
+	}
+}
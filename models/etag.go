@@ -0,0 +1,50 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// etag считает версию записи по её JSON: любое изменение, в том числе
+// списание со склада заказом, даёт новый тег.
+func etag(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// ETag не учитывает вычисляемое наличие: оно меняется вместе со складом,
+// а не с самим блюдом.
+func (m MenuItem) ETag() string {
+	m.Stock = nil
+	return etag(m)
+}
+
+func (i InventoryItem) ETag() string {
+	return etag(i)
+}
+
+func (o Order) ETag() string {
+	return etag(o)
+}
+
+// MatchETag сообщает, подходит ли тег под заголовок If-Match или
+// If-None-Match: список тегов через запятую или "*". Слабые теги (W/)
+// сравниваются без учёта пометки. Пустой заголовок подходит всегда.
+func MatchETag(header, tag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
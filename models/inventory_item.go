@@ -5,4 +5,38 @@ type InventoryItem struct {
 	Name         string  `json:"name"`
 	Quantity     float64 `json:"quantity"`
 	Unit         string  `json:"unit"`
+	ReorderPoint float64 `json:"reorder_point,omitempty"` // при остатке не выше этого пора заказывать
+	ParLevel     float64 `json:"par_level,omitempty"`     // до какого остатка дозаказывать
+	ArchivedAt   string  `json:"archived_at,omitempty"`   // мягко удалён, но на него ещё ссылаются
+
+	Recipe *PreparedRecipe `json:"recipe,omitempty"` // есть только у заготовок
+}
+
+// PreparedRecipe — рецепт заготовки: из Ingredients получается Yield единиц
+// заготовки (в её единице склада).
+type PreparedRecipe struct {
+	Yield       float64              `json:"yield"`
+	Ingredients []MenuItemIngredient `json:"ingredients"`
+}
+
+func (i InventoryItem) Prepared() bool {
+	return i.Recipe != nil
+}
+
+func (i InventoryItem) Archived() bool {
+	return i.ArchivedAt != ""
+}
+
+// Uses сообщает, входит ли ингредиент в рецепт заготовки.
+func (i InventoryItem) Uses(ingredientID string) bool {
+	if i.Recipe == nil {
+		return false
+	}
+	_, ok := findLine(i.Recipe.Ingredients, ingredientID)
+	return ok
+}
+
+type LowStockItem struct {
+	InventoryItem
+	ReorderQuantity float64 `json:"reorder_quantity"`
 }
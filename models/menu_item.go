@@ -1,14 +1,233 @@
 package models
 
+import (
+	"hot-coffee/internal/errorHandle"
+	"strings"
+)
+
 type MenuItem struct {
 	ID          string               `json:"product_id"`
 	Name        string               `json:"name"`
 	Description string               `json:"description"`
-	Price       float64              `json:"price"`
+	Price       Money                `json:"price"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
+	Variants    []VariantGroup       `json:"variants,omitempty"`
+	Modifiers   []Modifier           `json:"modifiers,omitempty"`
+	Category    Category             `json:"category,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	SortOrder   int                  `json:"sort_order,omitempty"`
+	Available   *Availability        `json:"availability,omitempty"`
+	Stock       *StockStatus         `json:"stock,omitempty"` // вычисляется при чтении, не хранится
+	ArchivedAt  string               `json:"archived_at,omitempty"`
+}
+
+func (m MenuItem) Archived() bool {
+	return m.ArchivedAt != ""
+}
+
+// Uses сообщает, входит ли ингредиент в рецепт блюда или в его модификаторы.
+func (m MenuItem) Uses(ingredientID string) bool {
+	if _, ok := findLine(m.Ingredients, ingredientID); ok {
+		return true
+	}
+	for _, modifier := range m.Modifiers {
+		if _, ok := findLine(modifier.Add, ingredientID); ok {
+			return true
+		}
+		for _, substitution := range modifier.Replace {
+			if substitution.To == ingredientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func findLine(lines []MenuItemIngredient, ingredientID string) (MenuItemIngredient, bool) {
+	for _, line := range lines {
+		if line.IngredientID == ingredientID {
+			return line, true
+		}
+	}
+	return MenuItemIngredient{}, false
+}
+
+// StockStatus — сколько порций блюда (базовый рецепт) можно приготовить из
+// текущих остатков и какой ингредиент кончится первым.
+type StockStatus struct {
+	Available          bool   `json:"available"`
+	MaxPortions        int    `json:"max_portions"`
+	LimitingIngredient string `json:"limiting_ingredient,omitempty"`
+	ProduciblePortions int    `json:"producible_portions,omitempty"` // если приготовить недостающие заготовки
+}
+
+type MenuStock struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	StockStatus
+}
+
+func (m MenuItem) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
 }
 
 type MenuItemIngredient struct {
 	IngredientID string  `json:"ingredient_id"`
 	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit,omitempty"` // пусто — единица склада
+}
+
+// VariantGroup — группа, из которой в заказе выбирается ровно один вариант,
+// например размер S/M/L. Без выбора берётся Default.
+type VariantGroup struct {
+	Name    string    `json:"name"`
+	Default string    `json:"default"`
+	Options []Variant `json:"options"`
+}
+
+// Variant умножает базовый рецепт на Multiplier (0 — без изменений) и
+// добавляет PriceDelta к цене.
+type Variant struct {
+	ID         string  `json:"id"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	PriceDelta Money   `json:"price_delta"`
+}
+
+// Modifier меняет рецепт: заменяет ингредиенты (то же количество),
+// убирает их или добавляет новые. Добавленное не умножается на размер.
+type Modifier struct {
+	ID         string               `json:"id"`
+	Name       string               `json:"name,omitempty"`
+	PriceDelta Money                `json:"price_delta"`
+	Replace    []Substitution       `json:"replace,omitempty"`
+	Remove     []string             `json:"remove,omitempty"`
+	Add        []MenuItemIngredient `json:"add,omitempty"`
+}
+
+type Substitution struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (g VariantGroup) option(id string) (Variant, bool) {
+	if id == "" {
+		id = g.Default
+	}
+	for _, option := range g.Options {
+		if option.ID == id {
+			return option, true
+		}
+	}
+	return Variant{}, false
+}
+
+func (m MenuItem) modifier(id string) (Modifier, bool) {
+	for _, modifier := range m.Modifiers {
+		if modifier.ID == id {
+			return modifier, true
+		}
+	}
+	return Modifier{}, false
+}
+
+// Recipe собирает рецепт и цену одной порции с выбранными вариантами
+// и модификаторами. Неизвестный выбор — ошибка InvalidOption.
+func (m MenuItem) Recipe(variants map[string]string, modifiers []string) ([]MenuItemIngredient, Money, error) {
+	price := m.Price
+	multiplier := 1.0
+
+	for name := range variants {
+		if !m.hasGroup(name) {
+			return nil, Money{}, errorHandle.InvalidOption
+		}
+	}
+	for _, group := range m.Variants {
+		option, ok := group.option(variants[group.Name])
+		if !ok {
+			return nil, Money{}, errorHandle.InvalidOption
+		}
+		if option.Multiplier > 0 {
+			multiplier *= option.Multiplier
+		}
+		var err error
+		if price, err = price.Add(option.PriceDelta); err != nil {
+			return nil, Money{}, err
+		}
+	}
+
+	recipe := make([]MenuItemIngredient, 0, len(m.Ingredients))
+	for _, ingredient := range m.Ingredients {
+		ingredient.Quantity *= multiplier
+		recipe = append(recipe, ingredient)
+	}
+
+	seen := make(map[string]bool, len(modifiers))
+	for _, id := range modifiers {
+		modifier, ok := m.modifier(id)
+		if !ok || seen[id] {
+			return nil, Money{}, errorHandle.InvalidOption
+		}
+		seen[id] = true
+
+		recipe = modifier.apply(recipe)
+		var err error
+		if price, err = price.Add(modifier.PriceDelta); err != nil {
+			return nil, Money{}, err
+		}
+	}
+	return recipe, price, nil
+}
+
+func (m MenuItem) hasGroup(name string) bool {
+	for _, group := range m.Variants {
+		if group.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (mod Modifier) apply(recipe []MenuItemIngredient) []MenuItemIngredient {
+	result := make([]MenuItemIngredient, 0, len(recipe)+len(mod.Add))
+	for _, ingredient := range recipe {
+		if contains(mod.Remove, ingredient.IngredientID) {
+			continue
+		}
+		for _, substitution := range mod.Replace {
+			if substitution.From == ingredient.IngredientID {
+				ingredient.IngredientID = substitution.To
+				break
+			}
+		}
+		result = append(result, ingredient)
+	}
+
+	for _, added := range mod.Add {
+		merged := false
+		for n := range result {
+			if result[n].IngredientID == added.IngredientID && result[n].Unit == added.Unit {
+				result[n].Quantity += added.Quantity
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			result = append(result, added)
+		}
+	}
+	return result
+}
+
+func contains(items []string, item string) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+	return false
 }
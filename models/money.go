@@ -0,0 +1,214 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/errorHandle"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Валюта старых записей, где цена была просто числом.
+const DefaultCurrency = "USD"
+
+// Число знаков после запятой (minor units) по ISO 4217.
+var currencyExponents = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"RUB": 2,
+	"KZT": 2,
+	"JPY": 0,
+	"KWD": 3,
+}
+
+// Money — сумма в минимальных единицах валюты (центах, тиынах).
+// В JSON записывается как {"amount": "3.50", "currency": "USD"}, а нулевое
+// значение без валюты (сумма не задана) — как null.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func currencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, errorHandle.UnknownCurrency
+	}
+	return exp, nil
+}
+
+// ParseMoney разбирает десятичную строку. Лишние знаки после запятой
+// округляются по правилу roundHalfUp — единственному месту округления сумм.
+func ParseMoney(value, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	exp, err := currencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" && fraction == "" || !digitsOnly(whole) || !digitsOnly(fraction) {
+		return Money{}, errorHandle.ErrorFormatJson
+	}
+
+	// Разряды, которые не помещаются в minor units, идут в округление.
+	var rest string
+	if len(fraction) > exp {
+		fraction, rest = fraction[:exp], fraction[exp:]
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	amount, err := strconv.ParseInt("0"+whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, errorHandle.ErrorFormatJson
+	}
+	amount = roundHalfUp(amount, rest)
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// roundHalfUp округляет модуль суммы по отброшенным цифрам: 0.5 и больше — вверх.
+func roundHalfUp(amount int64, dropped string) int64 {
+	if dropped != "" && dropped[0] >= '5' {
+		return amount + 1
+	}
+	return amount
+}
+
+func digitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Mul умножает цену на количество без потери точности; результат, не
+// помещающийся в int64, — ошибка AmountOverflow.
+func (m Money) Mul(quantity int64) (Money, error) {
+	amount := m.Amount * quantity
+	if m.Amount != 0 && (amount/m.Amount != quantity || m.Amount == -1 && quantity == math.MinInt64) {
+		return Money{}, errorHandle.AmountOverflow
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Add складывает суммы одной валюты. Нулевая сумма без валюты принимает валюту второй.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency == "" {
+		return other, nil
+	}
+	if other.Currency != "" && other.Currency != m.Currency {
+		return Money{}, errorHandle.CurrencyMismatch
+	}
+	amount := m.Amount + other.Amount
+	if other.Amount > 0 && amount < m.Amount || other.Amount < 0 && amount > m.Amount {
+		return Money{}, errorHandle.AmountOverflow
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+func (m Money) String() string {
+	exp, err := currencyExponent(m.Currency)
+	if err != nil {
+		exp = 2
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+
+	scale := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exp, amount%scale)
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) IsZero() bool {
+	return m == Money{}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.IsZero() {
+		return []byte("null"), nil
+	}
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	amount, _ := json.Marshal(Money{Amount: m.Amount, Currency: currency}.String())
+	return json.Marshal(moneyJSON{Amount: amount, Currency: currency})
+}
+
+// UnmarshalJSON принимает объект {"amount", "currency"}, а также число или
+// строку, как цена хранилась в menu_items.json раньше. Число разбирается как
+// десятичный текст, без промежуточного float64, поэтому запись с экспонентой
+// ("1e2") не принимается.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		var raw moneyJSON
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		raw.Amount = bytes.TrimSpace(raw.Amount)
+		if len(raw.Amount) == 0 || string(raw.Amount) == "null" {
+			return amountError("required", "is required")
+		}
+		return m.parse(raw.Amount, raw.Currency)
+	}
+	return m.parse(data, DefaultCurrency)
+}
+
+func (m *Money) parse(amount []byte, currency string) error {
+	var text string
+	if len(amount) > 0 && amount[0] == '"' {
+		if err := json.Unmarshal(amount, &text); err != nil {
+			return err
+		}
+	} else {
+		var number json.Number
+		if err := json.Unmarshal(amount, &number); err != nil {
+			return err
+		}
+		text = number.String()
+		if strings.ContainsAny(text, "eE") {
+			return amountError("invalid_format", "must be a decimal without an exponent")
+		}
+	}
+
+	parsed, err := ParseMoney(text, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func amountError(code, message string) error {
+	return errorHandle.ErrorFormatJson.WithDetails(errorHandle.Detail{Field: "amount", Code: code, Message: message})
+}
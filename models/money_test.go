@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"hot-coffee/internal/errorHandle"
+	"math"
+	"testing"
+)
+
+func TestMoneyUnmarshal(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Money
+		err   error
+	}{
+		{`{"amount": "3.50", "currency": "USD"}`, Money{Amount: 350, Currency: "USD"}, nil},
+		{`{"amount": 3.505, "currency": "usd"}`, Money{Amount: 351, Currency: "USD"}, nil},
+		{`4.5`, Money{Amount: 450, Currency: DefaultCurrency}, nil},
+		{`{"currency": "USD"}`, Money{}, errorHandle.ErrorFormatJson},
+		{`{"amount": null}`, Money{}, errorHandle.ErrorFormatJson},
+		{`{"amount": 1e2}`, Money{}, errorHandle.ErrorFormatJson},
+		{`1E-2`, Money{}, errorHandle.ErrorFormatJson},
+		{`{"amount": "1", "currency": "XYZ"}`, Money{}, errorHandle.UnknownCurrency},
+	}
+	for _, test := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(test.input), &got)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: got error %v, want %v", test.input, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %+v, %v, want %+v", test.input, got, err, test.want)
+		}
+	}
+}
+
+func TestMoneyOverflow(t *testing.T) {
+	price := Money{Amount: math.MaxInt64 / 2, Currency: "USD"}
+	if _, err := price.Mul(3); !errors.Is(err, errorHandle.AmountOverflow) {
+		t.Errorf("Mul: got %v, want %v", err, errorHandle.AmountOverflow)
+	}
+	if _, err := (Money{Amount: -1, Currency: "USD"}).Mul(math.MinInt64); !errors.Is(err, errorHandle.AmountOverflow) {
+		t.Errorf("Mul by MinInt64: got %v, want %v", err, errorHandle.AmountOverflow)
+	}
+	if _, err := price.Add(price); err != nil {
+		t.Errorf("Add within range: %v", err)
+	}
+	if _, err := price.Add(Money{Amount: math.MaxInt64/2 + 2, Currency: "USD"}); !errors.Is(err, errorHandle.AmountOverflow) {
+		t.Errorf("Add: got %v, want %v", err, errorHandle.AmountOverflow)
+	}
+	if got, err := price.Mul(2); err != nil || got.Amount != math.MaxInt64-1 {
+		t.Errorf("Mul(2) = %+v, %v", got, err)
+	}
+}
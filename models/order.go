@@ -1,14 +1,84 @@
 package models
 
+import "encoding/json"
+
+type OrderStatus string
+
+const (
+	StatusReceived      OrderStatus = "received"
+	StatusInPreparation OrderStatus = "in_preparation"
+	StatusReady         OrderStatus = "ready"
+	StatusPickedUp      OrderStatus = "picked_up"
+	StatusCancelled     OrderStatus = "cancelled"
+	StatusRefunded      OrderStatus = "refunded"
+)
+
+// UnmarshalJSON переводит статусы старых заказов: Open — принят, Close — выдан.
+func (s *OrderStatus) UnmarshalJSON(data []byte) error {
+	var status string
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	switch status {
+	case "Open":
+		*s = StatusReceived
+	case "Close":
+		*s = StatusPickedUp
+	default:
+		*s = OrderStatus(status)
+	}
+	return nil
+}
+
+// Active — заказ ещё не выдан и не отменён: его ингредиенты списаны, но могут вернуться на склад.
+func (s OrderStatus) Active() bool {
+	return s == StatusReceived || s == StatusInPreparation || s == StatusReady
+}
+
+type StatusChange struct {
+	Status OrderStatus `json:"status"`
+	At     string      `json:"at"`
+}
+
 type Order struct {
-	ID           string      `json:"order_id"`
-	CustomerName string      `json:"customer_name"`
-	Items        []OrderItem `json:"items"`
-	Status       string      `json:"status"`
-	CreatedAt    string      `json:"created_at"`
+	ID            string         `json:"order_id"`
+	CustomerName  string         `json:"customer_name"`
+	Items         []OrderItem    `json:"items"`
+	Status        OrderStatus    `json:"status"`
+	StatusHistory []StatusChange `json:"status_history,omitempty"`
+	CreatedAt     string         `json:"created_at"`
+	Subtotal      Money          `json:"subtotal"`
+	Total         Money          `json:"total"`
 }
 
+// OrderItem хранит название, цену и рецепт блюда на момент заказа, чтобы
+// изменение меню не меняло уже оформленные заказы, отчёты по ним и то,
+// что вернётся на склад при отмене.
 type OrderItem struct {
-	ProductID string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
+	ProductID string               `json:"product_id"`
+	Quantity  int                  `json:"quantity"`
+	Variants  map[string]string    `json:"variants,omitempty"` // группа → вариант, например "size": "L"
+	Modifiers []string             `json:"modifiers,omitempty"`
+	Name      string               `json:"name,omitempty"`
+	UnitPrice Money                `json:"unit_price"`
+	LineTotal Money                `json:"line_total"`
+	Recipe    []MenuItemIngredient `json:"recipe,omitempty"` // одна порция в единицах склада
+}
+
+// SameSelection — та же позиция меню с теми же вариантами и модификаторами.
+func (i OrderItem) SameSelection(other OrderItem) bool {
+	if i.ProductID != other.ProductID || len(i.Variants) != len(other.Variants) || len(i.Modifiers) != len(other.Modifiers) {
+		return false
+	}
+	for group, option := range i.Variants {
+		if other.Variants[group] != option {
+			return false
+		}
+	}
+	for n := range i.Modifiers {
+		if i.Modifiers[n] != other.Modifiers[n] {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,48 @@
+package models
+
+type MovementReason string
+
+const (
+	ReasonOrderConsumption  MovementReason = "order_consumption"
+	ReasonOrderCancellation MovementReason = "order_cancellation"
+	ReasonManualAdjustment  MovementReason = "manual_adjustment"
+	ReasonDelivery          MovementReason = "delivery"
+	ReasonWaste             MovementReason = "waste"
+	ReasonStockCount        MovementReason = "stock_count"
+	ReasonProduction        MovementReason = "production"       // заготовка приготовлена
+	ReasonProductionInput   MovementReason = "production_input" // ушло на заготовку
+)
+
+type StockMovement struct {
+	ID           int64          `json:"movement_id"`
+	IngredientID string         `json:"ingredient_id"`
+	Reason       MovementReason `json:"reason"`
+	Delta        float64        `json:"delta"`
+	Balance      float64        `json:"balance"`
+	ReferenceID  string         `json:"reference_id,omitempty"`
+	CreatedAt    string         `json:"created_at"`
+}
+
+// StockAdjustment — относительное изменение остатка ингредиента.
+type StockAdjustment struct {
+	IngredientID string         `json:"ingredient_id"`
+	Delta        float64        `json:"delta"`
+	Reason       MovementReason `json:"reason"`
+	ReferenceID  string         `json:"reference_id,omitempty"`
+}
+
+type Delivery struct {
+	IngredientID string  `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+}
+
+type Restock struct {
+	ReferenceID string     `json:"reference_id,omitempty"`
+	Items       []Delivery `json:"items"`
+}
+
+// Production — партия заготовки. Без Quantity готовится одна партия по рецепту.
+type Production struct {
+	Quantity    float64 `json:"quantity,omitempty"`
+	ReferenceID string  `json:"reference_id,omitempty"`
+}
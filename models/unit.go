@@ -0,0 +1,92 @@
+package models
+
+import (
+	"hot-coffee/internal/errorHandle"
+	"math"
+	"strings"
+)
+
+type Dimension string
+
+const (
+	DimensionMass   Dimension = "mass"
+	DimensionVolume Dimension = "volume"
+	DimensionCount  Dimension = "count"
+)
+
+// Unit — единица измерения. Factor переводит её в базовую единицу
+// своей размерности: граммы, миллилитры или штуки.
+type Unit struct {
+	Code      string
+	Dimension Dimension
+	Factor    float64
+}
+
+var units = map[string]Unit{}
+
+func init() {
+	for _, unit := range []Unit{
+		{"mg", DimensionMass, 0.001},
+		{"g", DimensionMass, 1},
+		{"kg", DimensionMass, 1000},
+		{"oz", DimensionMass, 28.349523125},
+		{"lb", DimensionMass, 453.59237},
+
+		{"ml", DimensionVolume, 1},
+		{"cl", DimensionVolume, 10},
+		{"l", DimensionVolume, 1000},
+		{"tsp", DimensionVolume, 5},
+		{"tbsp", DimensionVolume, 15},
+		{"cup", DimensionVolume, 240},
+		{"fl_oz", DimensionVolume, 29.5735295625},
+
+		{"pcs", DimensionCount, 1},
+		{"shots", DimensionCount, 1},
+		{"dozen", DimensionCount, 12},
+	} {
+		units[unit.Code] = unit
+	}
+
+	aliases := map[string]string{
+		"gram": "g", "grams": "g", "kilogram": "kg", "kilograms": "kg",
+		"liter": "l", "liters": "l", "litre": "l", "litres": "l",
+		"milliliter": "ml", "milliliters": "ml",
+		"pc": "pcs", "piece": "pcs", "pieces": "pcs", "shot": "shots",
+	}
+	for alias, code := range aliases {
+		units[alias] = units[code]
+	}
+}
+
+// LookupUnit ищет единицу по коду без учёта регистра.
+func LookupUnit(code string) (Unit, error) {
+	unit, ok := units[strings.ToLower(strings.TrimSpace(code))]
+	if !ok {
+		return Unit{}, errorHandle.UnknownUnit
+	}
+	return unit, nil
+}
+
+// ConvertQuantity переводит quantity из единицы from в единицу to.
+// Пустая from означает, что количество уже задано в единице to.
+func ConvertQuantity(quantity float64, from, to string) (float64, error) {
+	if from == "" || strings.EqualFold(from, to) {
+		return quantity, nil
+	}
+
+	fromUnit, err := LookupUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	toUnit, err := LookupUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	if fromUnit.Dimension != toUnit.Dimension {
+		return 0, errorHandle.UnitMismatch
+	}
+
+	// Округление убирает хвосты вроде 0.30000000000000004 после умножения.
+	converted := quantity * fromUnit.Factor / toUnit.Factor
+	return math.Round(converted*1e9) / 1e9, nil
+}